@@ -0,0 +1,390 @@
+package coffutils
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	gtutils "github.com/pangine/disasm-gt-generator/gtutils"
+)
+
+// UNWIND_INFO flags
+const (
+	unwFlagEHandler  = 0x1
+	unwFlagUHandler  = 0x2
+	unwFlagChainInfo = 0x4
+)
+
+// peImage reads a PE image by relative virtual addresses
+type peImage struct {
+	imageBase int
+	ptrSize   int
+	sections  []*pe.Section
+	data      map[*pe.Section][]byte
+	imports   int // RVA of the import directory
+}
+
+// openPeImage reads the sections of a PE image, nil if it cannot be read
+func openPeImage(binFile string) *peImage {
+	f, err := pe.Open(binFile)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	img := &peImage{
+		data: make(map[*pe.Section][]byte),
+	}
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader64:
+		img.imageBase, img.ptrSize = int(oh.ImageBase), 8
+		img.imports = int(oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_IMPORT].VirtualAddress)
+	case *pe.OptionalHeader32:
+		img.imageBase, img.ptrSize = int(oh.ImageBase), 4
+		img.imports = int(oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_IMPORT].VirtualAddress)
+	default:
+		return nil
+	}
+	for _, sec := range f.Sections {
+		data, err := sec.Data()
+		if err != nil {
+			continue
+		}
+		img.sections = append(img.sections, sec)
+		img.data[sec] = data
+	}
+	return img
+}
+
+// bytesAt returns the bytes from rva to the end of its section
+func (img *peImage) bytesAt(rva int) []byte {
+	for _, sec := range img.sections {
+		start := int(sec.VirtualAddress)
+		if rva < start || rva >= start+int(sec.VirtualSize) {
+			continue
+		}
+		data := img.data[sec]
+		if rva-start >= len(data) {
+			return nil
+		}
+		return data[rva-start:]
+	}
+	return nil
+}
+
+// u32 reads a 32-bit value at rva
+func (img *peImage) u32(rva int) (value int, ok bool) {
+	data := img.bytesAt(rva)
+	if len(data) < 4 {
+		return 0, false
+	}
+	return int(binary.LittleEndian.Uint32(data)), true
+}
+
+// section returns the data of the named section
+func (img *peImage) section(name string) (rva int, data []byte) {
+	for _, sec := range img.sections {
+		if sec.Name == name {
+			return int(sec.VirtualAddress), img.data[sec]
+		}
+	}
+	return
+}
+
+// fh4Reader reads the compressed __CxxFrameHandler4 data
+type fh4Reader struct {
+	img *peImage
+	rva int
+}
+
+func (r *fh4Reader) u8() int {
+	data := r.img.bytesAt(r.rva)
+	r.rva++
+	if len(data) == 0 {
+		return 0
+	}
+	return int(data[0])
+}
+
+// int32 reads a plain 32-bit value, RVAs are stored this way
+func (r *fh4Reader) int32() int {
+	value, _ := r.img.u32(r.rva)
+	r.rva += 4
+	return value
+}
+
+// unsigned reads a compressed unsigned integer. The lowest bits of the first
+// byte tell the length of the integer.
+func (r *fh4Reader) unsigned() int {
+	data := r.img.bytesAt(r.rva)
+	if len(data) == 0 {
+		return 0
+	}
+	lengthBits := data[0] & 0x0f
+	var length int
+	switch {
+	case lengthBits == 0x0f:
+		length = 5
+	case lengthBits&0x07 == 0x07:
+		length = 4
+	case lengthBits&0x03 == 0x03:
+		length = 3
+	case lengthBits&0x01 == 0x01:
+		length = 2
+	default:
+		length = 1
+	}
+	if len(data) < length {
+		r.rva += length
+		return 0
+	}
+	r.rva += length
+	if length == 5 {
+		return int(binary.LittleEndian.Uint32(data[1:5]))
+	}
+	var value uint32
+	for i := 0; i < length; i++ {
+		value |= uint32(data[i]) << uint(8*(4-length+i))
+	}
+	return int(value >> uint(32-7*length))
+}
+
+// sehResolver collects the funclets and handlers of an image
+type sehResolver struct {
+	img      *peImage
+	funclets map[int]gtutils.Funclet // Keyed by funclet RVA, parents are RVAs
+	handlers map[int]bool            // __except blocks inside their functions
+}
+
+func (s *sehResolver) addFunclet(rva, parent int, kind string) {
+	if rva == 0 || rva == parent {
+		return
+	}
+	if _, ok := s.funclets[rva]; ok {
+		return
+	}
+	s.funclets[rva] = gtutils.Funclet{Kind: kind, Parent: parent}
+}
+
+// scopeTable reads the scope table of __C_specific_handler
+func (s *sehResolver) scopeTable(lsda, parent int) {
+	count, ok := s.img.u32(lsda)
+	if !ok {
+		return
+	}
+	for i := 0; i < count; i++ {
+		entry := lsda + 4 + i*16
+		handler, _ := s.img.u32(entry + 8)
+		target, _ := s.img.u32(entry + 12)
+		if target != 0 {
+			// __except: handler is a filter funclet or a constant filter result
+			s.handlers[target] = true
+			if handler > 0xff {
+				s.addFunclet(handler, parent, gtutils.FuncletFilter)
+			}
+		} else {
+			// __finally: handler is the termination handler funclet
+			s.addFunclet(handler, parent, gtutils.FuncletFinally)
+		}
+	}
+}
+
+// isFuncInfo3 checks the magic number of a __CxxFrameHandler3 FuncInfo
+func (s *sehResolver) isFuncInfo3(funcInfo int) bool {
+	magic, ok := s.img.u32(funcInfo)
+	magic &= 0x1fffffff
+	return ok && magic >= 0x19930520 && magic <= 0x19930522
+}
+
+// funcInfo3 reads the unwind map and catch handlers of a __CxxFrameHandler3 FuncInfo
+func (s *sehResolver) funcInfo3(funcInfo, parent int) {
+	maxState, _ := s.img.u32(funcInfo + 4)
+	unwindMap, _ := s.img.u32(funcInfo + 8)
+	nTryBlocks, _ := s.img.u32(funcInfo + 12)
+	tryBlockMap, _ := s.img.u32(funcInfo + 16)
+	for i := 0; unwindMap != 0 && i < maxState; i++ {
+		action, _ := s.img.u32(unwindMap + i*8 + 4)
+		s.addFunclet(action, parent, gtutils.FuncletUnwind)
+	}
+	for i := 0; tryBlockMap != 0 && i < nTryBlocks; i++ {
+		tryBlock := tryBlockMap + i*20
+		nCatches, _ := s.img.u32(tryBlock + 12)
+		handlerArray, _ := s.img.u32(tryBlock + 16)
+		for j := 0; handlerArray != 0 && j < nCatches; j++ {
+			handler, _ := s.img.u32(handlerArray + j*20 + 12)
+			s.addFunclet(handler, parent, gtutils.FuncletCatch)
+		}
+	}
+}
+
+// funcInfo4 reads the unwind map and catch handlers of a __CxxFrameHandler4 FuncInfo
+func (s *sehResolver) funcInfo4(funcInfo, parent int) {
+	r := &fh4Reader{img: s.img, rva: funcInfo}
+	header := r.u8()
+	if header&0x04 != 0 {
+		r.unsigned() // BBT flags
+	}
+	var unwindMap, tryBlockMap int
+	if header&0x08 != 0 {
+		unwindMap = r.int32()
+	}
+	if header&0x10 != 0 {
+		tryBlockMap = r.int32()
+	}
+	if unwindMap != 0 {
+		u := &fh4Reader{img: s.img, rva: unwindMap}
+		for n := u.unsigned(); n > 0; n-- {
+			switch u.unsigned() & 0x03 {
+			case 1, 2:
+				// Destructor called with the object, not a funclet
+				u.int32()
+				u.unsigned()
+			case 3:
+				s.addFunclet(u.int32(), parent, gtutils.FuncletUnwind)
+			}
+		}
+	}
+	if tryBlockMap != 0 {
+		t := &fh4Reader{img: s.img, rva: tryBlockMap}
+		for n := t.unsigned(); n > 0; n-- {
+			t.unsigned() // tryLow
+			t.unsigned() // tryHigh
+			t.unsigned() // catchHigh
+			handlerArray := t.int32()
+			if handlerArray == 0 {
+				continue
+			}
+			h := &fh4Reader{img: s.img, rva: handlerArray}
+			for m := h.unsigned(); m > 0; m-- {
+				hHeader := h.u8()
+				if hHeader&0x01 != 0 {
+					h.unsigned() // adjectives
+				}
+				if hHeader&0x02 != 0 {
+					h.int32() // type descriptor
+				}
+				if hHeader&0x04 != 0 {
+					h.unsigned() // catch object displacement
+				}
+				s.addFunclet(h.int32(), parent, gtutils.FuncletCatch)
+				for c := (hHeader >> 4) & 0x03; c > 0; c-- {
+					if hHeader&0x08 != 0 {
+						h.int32()
+					} else {
+						h.unsigned()
+					}
+				}
+			}
+		}
+	}
+}
+
+// ResolveSEH parses .pdata/.xdata of an x64 image to find exception handling
+// funclets and __except blocks. Funclets are keyed by their addresses,
+// parents are addresses of the primary functions.
+func ResolveSEH(
+	binFile string,
+	symbolFuncs []gtutils.SymbolFuncInfo,
+) (funclets map[int]gtutils.Funclet, handlers map[int]bool) {
+	funclets = make(map[int]gtutils.Funclet)
+	handlers = make(map[int]bool)
+	img := openPeImage(binFile)
+	if img == nil || img.ptrSize != 8 {
+		// Only x64 images have table based exception handling
+		return
+	}
+	rvaToOffset := func(rva int) int {
+		return img.imageBase + rva
+	}
+	names := make(map[int]string)
+	for _, e := range symbolFuncs {
+		names[e.Offset] = e.Function
+	}
+
+	_, pdata := img.section(".pdata")
+	type runtimeFunction struct {
+		begin  int
+		unwind int
+	}
+	entries := make([]runtimeFunction, 0, len(pdata)/12)
+	for i := 0; i+12 <= len(pdata); i += 12 {
+		begin := int(binary.LittleEndian.Uint32(pdata[i:]))
+		unwind := int(binary.LittleEndian.Uint32(pdata[i+8:]))
+		if begin == 0 {
+			break
+		}
+		entries = append(entries, runtimeFunction{begin: begin, unwind: unwind})
+	}
+
+	// Chained unwind info marks function parts split from a primary function
+	primary := make(map[int]int)
+	for _, e := range entries {
+		info := img.bytesAt(e.unwind)
+		if len(info) < 4 || (info[0]>>3)&unwFlagChainInfo == 0 {
+			continue
+		}
+		codes := (int(info[2]) + 1) &^ 1
+		if chained, ok := img.u32(e.unwind + 4 + codes*2); ok {
+			primary[e.begin] = chained
+		}
+	}
+	primaryOf := func(rva int) int {
+		for i := 0; i < len(entries); i++ {
+			p, ok := primary[rva]
+			if !ok {
+				break
+			}
+			rva = p
+		}
+		return rva
+	}
+
+	s := &sehResolver{
+		img:      img,
+		funclets: make(map[int]gtutils.Funclet),
+		handlers: make(map[int]bool),
+	}
+	for _, e := range entries {
+		info := img.bytesAt(e.unwind)
+		if len(info) < 4 {
+			continue
+		}
+		flags := info[0] >> 3
+		if flags&unwFlagChainInfo != 0 || flags&(unwFlagEHandler|unwFlagUHandler) == 0 {
+			continue
+		}
+		codes := (int(info[2]) + 1) &^ 1
+		handlerRVA, ok := img.u32(e.unwind + 4 + codes*2)
+		if !ok {
+			continue
+		}
+		lsda := e.unwind + 4 + codes*2 + 4
+		parent := primaryOf(e.begin)
+		if f, ok := s.funclets[parent]; ok {
+			// Handlers of a funclet belong to the function owning the funclet
+			parent = f.Parent
+		}
+		handlerName := names[rvaToOffset(handlerRVA)]
+		funcInfo, _ := img.u32(lsda)
+		switch {
+		case strings.Contains(handlerName, "__C_specific_handler"),
+			strings.Contains(handlerName, "__GSHandlerCheck_SEH"):
+			s.scopeTable(lsda, parent)
+		case strings.Contains(handlerName, "__CxxFrameHandler4"),
+			strings.Contains(handlerName, "__GSHandlerCheck_EH4"):
+			s.funcInfo4(funcInfo, parent)
+		case s.isFuncInfo3(funcInfo):
+			s.funcInfo3(funcInfo, parent)
+		}
+	}
+
+	for rva, f := range s.funclets {
+		f.Parent = rvaToOffset(f.Parent)
+		funclets[rvaToOffset(rva)] = f
+	}
+	for rva := range s.handlers {
+		handlers[rvaToOffset(rva)] = true
+	}
+	fmt.Printf("\tINFO: %d exception handling funclets found\n", len(funclets))
+	return
+}
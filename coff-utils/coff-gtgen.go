@@ -14,18 +14,19 @@ import (
 
 // CoffGroundtruthMatch is used to generate ground truth on target coff binary file
 func CoffGroundtruthMatch(
-	asmDir, odjDir, mthFile, binName string,
+	asmDir, odjDir, mthFile, binFile string,
 	symbolFuncs []gtutils.SymbolFuncInfo,
 	aoMap map[string]string,
+	libFuncs gtutils.LibraryIndex,
 	bi pstruct.BinaryInfo,
 	llvmTripleStruct genutils.LlvmTripleStruct,
 	noCheckFuncSize bool,
 ) (
 	insts map[int]gtutils.InsnSupplementary,
 	funcs map[gtutils.FuncRow][]int,
+	extra gtutils.GtExtra,
 	failure bool,
 ) {
-	binName = strings.TrimSuffix(binName, ".exe")
 	bout, err := os.Create(mthFile)
 	if err != nil {
 		fmt.Printf("FATAL: mth file %s can not be written.\n", mthFile)
@@ -66,14 +67,41 @@ func CoffGroundtruthMatch(
 		}
 	}
 
+	// Exception handling funclets are matched as functions but belong to their parents
+	funclets, sehHandlers := ResolveSEH(binFile, symbolFuncs)
+
 	mthLines := make([]string, len(symbolFuncs))
 	insts = make(map[int]gtutils.InsnSupplementary)
 	funcs = make(map[gtutils.FuncRow][]int)
 	usedLst := make(map[string]bool)
+	entryAligns := make(map[int]string)
+	// Symbols sharing one body (/OPT:ICF) only need one of them matched
+	folded := gtutils.FoldedOffsets(symbolFuncs)
+	bodyAt := make(map[int]string)
+	pendingAliases := make([]gtutils.SymbolFuncInfo, 0)
+	pendingNoCandidate := make(map[int]bool)
+	noListing := make([]gtutils.SymbolFuncInfo, 0)
 	for sID, symbol := range symbolFuncs {
 		fName := symbol.Function
+		if folded[symbol.Offset] {
+			if body, ok := bodyAt[symbol.Offset]; ok {
+				fmt.Printf("\tINFO: %s > %s is folded into %s\n", symbol.Source, fName, body)
+				extra.FuncAliases = append(extra.FuncAliases,
+					gtutils.FuncAliasRow{FuncStart: symbol.Offset, Name: fName})
+				continue
+			}
+		}
 		if len(funcCandidates[fName]) == 0 {
-			if strings.Index(symbol.Source, ":") < 0 {
+			if folded[symbol.Offset] {
+				pendingNoCandidate[len(pendingAliases)] = true
+				pendingAliases = append(pendingAliases, symbol)
+				continue
+			}
+			noListing = append(noListing, symbol)
+			if f, ok := funclets[symbol.Offset]; ok {
+				fmt.Printf("\tWARNING: no candidates for %s funclet %s of %x, it is not in the ground truth\n",
+					f.Kind, fName, f.Parent)
+			} else if strings.Index(symbol.Source, ":") < 0 {
 				// Source name with ":" are libraries, do not bother then at now.
 				fmt.Printf("\tWARNING: no candidates for %s > %s\n",
 					symbol.Source, fName)
@@ -130,12 +158,18 @@ func CoffGroundtruthMatch(
 				fmt.Println("\t" + mthLines[sID])
 				// Locale Aggressive new Root Search
 				// TODO: turn off
+				dataRegions := gtutils.ResolveDataRegions(funcByLst[lst][fName], symbol.Offset, bi)
 				gtutils.AggressiveRootSearch(partNewRoots,
 					partInsts,
 					symbol.Offset,
 					upbound,
+					dataRegions,
 					bi,
 					objx86coff.ObjectCoff{})
+				extra.DataRegions = append(extra.DataRegions, dataRegions...)
+				extra.Padding = append(extra.Padding,
+					gtutils.ResolvePadding(funcByLst[lst][fName], symbol.Offset, bi)...)
+				entryAligns[symbol.Offset] = funcByLst[lst][fName].EntryAlign
 				insnLst := make([]int, 0)
 				for insn, supplementary := range partInsts {
 					insnLst = append(insnLst, insn)
@@ -143,7 +177,7 @@ func CoffGroundtruthMatch(
 						insts[insn] = supplementary
 					} else {
 						// Already have this instruction
-						insts[insn] = gtutils.InsnSupplementary{Optional: supplementary.Optional && insts[insn].Optional}
+						insts[insn] = gtutils.MergeInsnSupplementary(insts[insn], supplementary)
 					}
 				}
 				funcs[gtutils.FuncRow{
@@ -151,6 +185,7 @@ func CoffGroundtruthMatch(
 					Start: symbol.Offset,
 					End:   upbound,
 				}] = insnLst
+				bodyAt[symbol.Offset] = symbol.Function
 				usedLst[lst] = true
 				break
 			} else {
@@ -161,7 +196,14 @@ func CoffGroundtruthMatch(
 				failToMatch = true
 			}
 		}
-		if failToMatch {
+		if f, ok := funclets[symbol.Offset]; ok && failToMatch {
+			fmt.Printf("\tWARNING: %s funclet %s of %x cannot find a match, it is not in the ground truth\n",
+				f.Kind, fName, f.Parent)
+			noListing = append(noListing, symbol)
+		} else if failToMatch && folded[symbol.Offset] {
+			// Another symbol of the same body may still match
+			pendingAliases = append(pendingAliases, symbol)
+		} else if failToMatch {
 			if strings.Index(symbol.Source, ":") < 0 {
 				fmt.Println("\tERROR: " + symbol.Source + " > " + fName + " cannot find a match\n")
 				failure = true
@@ -169,6 +211,58 @@ func CoffGroundtruthMatch(
 			}
 			// The function may come from a library, not existing lst.
 			fmt.Println("\tERROR: (WITHHOLD) " + symbol.Source + " > " + fName + " cannot find a match\n")
+			noListing = append(noListing, symbol)
+		}
+	}
+	for i, symbol := range pendingAliases {
+		if body, ok := bodyAt[symbol.Offset]; ok {
+			fmt.Printf("\tINFO: %s > %s is folded into %s\n", symbol.Source, symbol.Function, body)
+			extra.FuncAliases = append(extra.FuncAliases,
+				gtutils.FuncAliasRow{FuncStart: symbol.Offset, Name: symbol.Function})
+			continue
+		}
+		if strings.Index(symbol.Source, ":") >= 0 {
+			// Library functions
+			fmt.Println("\tERROR: (WITHHOLD) " + symbol.Source + " > " + symbol.Function + " cannot find a match\n")
+			noListing = append(noListing, symbol)
+		} else if pendingNoCandidate[i] {
+			fmt.Printf("\tWARNING: no candidates for %s > %s\n",
+				symbol.Source, symbol.Function)
+		} else {
+			fmt.Println("\tERROR: " + symbol.Source + " > " + symbol.Function + " cannot find a match\n")
+			failure = true
+			return
+		}
+	}
+	// Library code that no listing describes
+	gtutils.DecodeCodeRanges(gtutils.MatchLibraryFuncs(libFuncs, noListing, bi),
+		gtutils.OriginLibrary, insts, funcs, bi, objx86coff.ObjectCoff{})
+	// Linker generated code that no listing describes
+	gtutils.DecodeCodeRanges(CoffLinkerStubs(binFile, bi, noListing), gtutils.OriginLinker, insts, funcs, bi, objx86coff.ObjectCoff{})
+	// Calls through the IAT, e.g. call [__imp_ExitProcess]
+	importNames, slotRefs := ImportRefs(binFile, bi, insts)
+	extra.FuncAttrs = gtutils.AnnotateCalls(insts, funcs, importNames, slotRefs)
+	// Entry instrumentation and the padding reserved before function starts
+	entryPadding := gtutils.ResolveEntries(extra.FuncAttrs, insts, funcs, importNames, nil, true, bi)
+	extra.Padding = gtutils.FillPadding(append(extra.Padding, entryPadding...), funcs, symbolFuncs, entryAligns, bi, objx86coff.ObjectCoff{})
+	for f := range funcs {
+		if funclet, ok := funclets[f.Start]; ok {
+			attr := extra.FuncAttrs[f.Start]
+			attr.Funclet = funclet
+			extra.FuncAttrs[f.Start] = attr
+		}
+	}
+	// Compilers of the binary and every function
+	metadata, producers := CoffProducers(binFile, odjDir, symbolFuncs, funcs)
+	extra.Metadata = metadata
+	gtutils.SetFuncProducers(extra.FuncAttrs, producers)
+	extra.Prototypes = CoffPrototypes(binFile, funcs)
+	// Object relocations are only mapped onto ELF binaries
+	extra.Meta.Unsupported = []string{"address_taken", "jump_table", "symbolization"}
+	for handler := range sehHandlers {
+		if supplementary, ok := insts[handler]; ok {
+			supplementary.LandingPad = true
+			insts[handler] = supplementary
 		}
 	}
 	// TODO: global new root findings
@@ -0,0 +1,211 @@
+package coffutils
+
+import (
+	"bytes"
+	"debug/pe"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	gtutils "github.com/pangine/disasm-gt-generator/gtutils"
+)
+
+// coffRelocSize returns the number of bytes modified by a relocation type, 0 if unknown
+func coffRelocSize(machine uint16, rType uint16) int {
+	switch machine {
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		switch rType {
+		case 0x1: // ADDR64
+			return 8
+		case 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8, 0x9, 0xb: // ADDR32, ADDR32NB, REL32_*, SECREL
+			return 4
+		case 0xa: // SECTION
+			return 2
+		}
+	case pe.IMAGE_FILE_MACHINE_I386:
+		switch rType {
+		case 0x6, 0x7, 0xb, 0x14: // DIR32, DIR32NB, SECREL, REL32
+			return 4
+		case 0xa: // SECTION
+			return 2
+		}
+	}
+	return 0
+}
+
+// coffPointerReloc returns true if the relocation stores the address of its
+// target, as jump table entries do
+func coffPointerReloc(machine uint16, rType uint16) bool {
+	switch machine {
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		return rType == 0x1 || rType == 0x2 || rType == 0x3 // ADDR64, ADDR32, ADDR32NB
+	case pe.IMAGE_FILE_MACHINE_I386:
+		return rType == 0x6 || rType == 0x7 // DIR32, DIR32NB
+	}
+	return false
+}
+
+// ReadLibraryObjects reads the functions of all coff objects (.obj) and the
+// objects in all static libraries (.lib) under libDir.
+// Functions end at the next symbol in the same section or the section end.
+func ReadLibraryObjects(libDir string) (lib gtutils.LibraryIndex) {
+	lib = make(gtutils.LibraryIndex)
+	if libDir == "" {
+		return
+	}
+	filepath.Walk(libDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".obj":
+			f, err := pe.Open(path)
+			if err != nil {
+				fmt.Printf("\tWARNING: library object %s cannot be open as coff\n", path)
+				return nil
+			}
+			readLibraryObject(lib, f, filepath.Base(path))
+			f.Close()
+		case ".lib":
+			members, err := readArchive(path)
+			if err != nil {
+				fmt.Printf("\tWARNING: library %s cannot be read as an archive\n", path)
+				return nil
+			}
+			for _, m := range members {
+				f, err := pe.NewFile(bytes.NewReader(m.data))
+				if err != nil {
+					// Short import records of import libraries are not coff objects
+					continue
+				}
+				readLibraryObject(lib, f, filepath.Base(path)+"("+m.name+")")
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// readLibraryObject adds the functions of a coff object to lib
+func readLibraryObject(lib gtutils.LibraryIndex, f *pe.File, object string) {
+	// Symbols grouped by sections, section numbers start from 1
+	bySection := make(map[int][]*pe.Symbol)
+	for _, s := range f.Symbols {
+		if s.SectionNumber <= 0 || int(s.SectionNumber) > len(f.Sections) || s.StorageClass == 3 {
+			// Undefined, absolute, debug, or static section symbols
+			continue
+		}
+		bySection[int(s.SectionNumber)] = append(bySection[int(s.SectionNumber)], s)
+	}
+	for secNum, syms := range bySection {
+		sec := f.Sections[secNum-1]
+		if sec.Characteristics&pe.IMAGE_SCN_CNT_CODE == 0 {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			continue
+		}
+		mask := make([]bool, len(data))
+		// Pointers back into this section, e.g. jump table entries
+		pointers := make([]int, 0)
+		for _, r := range sec.Relocs {
+			size := coffRelocSize(f.Machine, r.Type)
+			for i := int(r.VirtualAddress); i < int(r.VirtualAddress)+size && i < len(mask); i++ {
+				mask[i] = true
+			}
+			if coffPointerReloc(f.Machine, r.Type) &&
+				int(r.SymbolTableIndex) < len(f.COFFSymbols) &&
+				int(f.COFFSymbols[r.SymbolTableIndex].SectionNumber) == secNum {
+				pointers = append(pointers, int(r.VirtualAddress))
+			}
+		}
+		sort.Ints(pointers)
+		sort.Slice(syms, func(i, j int) bool {
+			return syms[i].Value < syms[j].Value
+		})
+		for i, s := range syms {
+			if s.Type&0x20 == 0 {
+				// Not a function
+				continue
+			}
+			start, end := int(s.Value), len(data)
+			for _, next := range syms[i+1:] {
+				if int(next.Value) > start {
+					end = int(next.Value)
+					break
+				}
+			}
+			if start >= end {
+				continue
+			}
+			codeSize := end - start
+			lo := sort.SearchInts(pointers, start)
+			hi := sort.SearchInts(pointers, end)
+			// MSVC jump table entries are DD on both x86 and x64
+			if table := gtutils.TableStart(pointers[lo:hi], 4); table >= 0 {
+				codeSize = table - start
+			}
+			lib.Add(gtutils.LibraryFunc{
+				Name:      s.Name,
+				Object:    object,
+				Code:      data[start:end],
+				Relocated: mask[start:end],
+				CodeSize:  codeSize,
+			})
+		}
+	}
+}
+
+// archiveMember is an object file stored in a static library
+type archiveMember struct {
+	name string
+	data []byte
+}
+
+// readArchive reads the members of a static library in the ar format,
+// skipping the linker members and the long name table
+func readArchive(path string) (members []archiveMember, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	const magic = "!<arch>\n"
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		return nil, fmt.Errorf("%s is not an archive", path)
+	}
+	var longNames []byte
+	for pos := len(magic); pos+60 <= len(data); {
+		header := data[pos : pos+60]
+		name := strings.TrimSpace(string(header[:16]))
+		size, err := strconv.Atoi(strings.TrimSpace(string(header[48:58])))
+		if err != nil || pos+60+size > len(data) {
+			return members, fmt.Errorf("%s has a broken member header", path)
+		}
+		body := data[pos+60 : pos+60+size]
+		switch {
+		case name == "/" || name == "/<ECSYMBOLS>/":
+			// Linker members
+		case name == "//":
+			longNames = body
+		case strings.HasPrefix(name, "/"):
+			// Offset into the long name table
+			if off, err := strconv.Atoi(name[1:]); err == nil && off < len(longNames) {
+				name = string(longNames[off:])
+				if end := strings.IndexAny(name, "\x00\n"); end >= 0 {
+					name = name[:end]
+				}
+			}
+			members = append(members, archiveMember{name: strings.TrimSuffix(name, "/"), data: body})
+		default:
+			members = append(members, archiveMember{name: strings.TrimSuffix(name, "/"), data: body})
+		}
+		// Members are aligned to 2 bytes
+		pos += 60 + size + size%2
+	}
+	return
+}
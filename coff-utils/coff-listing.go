@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -77,9 +78,12 @@ func ReadLst(
 	// Second iteration, record instructions and labels in functions
 	var inTextSection, inFunction, lastIsAlign, lastNotFinished bool
 	var fName, lName string
-	var insnOffset, insnBytes, labelIndex int
+	var insnOffset, insnBytes, labelIndex, locLine int
+	var locFile string
+	var lineNumber, insnLine int
 	lines = bufio.NewScanner(bin)
 	for lines.Scan() {
+		lineNumber++
 		line := lines.Text()
 		fields := strings.Fields(line)
 		if len(fields) == 0 {
@@ -116,6 +120,8 @@ func ReadLst(
 			labelIndex = 0
 			lastIsAlign = false
 			lastNotFinished = false
+			// Source locations do not carry over from the previous function
+			locFile, locLine = "", 0
 			continue
 		}
 		// End of a function
@@ -145,13 +151,17 @@ func ReadLst(
 				labelIndex = 0
 				lastIsAlign = false
 				lastNotFinished = false
-			} else if funcMap[fName].Source == "" &&
-				strings.HasPrefix(line, "; File ") {
+			} else if strings.HasPrefix(line, "; File ") {
 				// Is a file directive
 				source := line[7:]
 				cutFrom := strings.LastIndex(source, "\\")
 				cutFrom++
-				funcMap[fName].Source = source[cutFrom:]
+				locFile = source[cutFrom:]
+				if funcMap[fName].Source == "" {
+					funcMap[fName].Source = locFile
+				}
+			} else if srcLine, ok := sourceLineComment(fields); ok {
+				locLine = srcLine
 			}
 			continue
 		}
@@ -165,6 +175,7 @@ func ReadLst(
 			if !lastNotFinished {
 				insnOffset = int(firstNumber64)
 				insnBytes = 0
+				insnLine = lineNumber
 			}
 		}
 		bytesInFrame := strings.Fields(frames[bytesFrame])
@@ -184,6 +195,7 @@ func ReadLst(
 		lastNotFinished = true
 		breakSign := ""
 		lastPiece := ""
+		pieces := make([]string, 0)
 		var meetComment bool
 		for i := bytesFrame + 1; i < len(frames) && !meetComment; i++ {
 			// Check if the the "insn" is actually a constant data
@@ -198,6 +210,7 @@ func ReadLst(
 					break
 				}
 				lastPiece = s
+				pieces = append(pieces, s)
 				if s != "" && breakSign == "" {
 					// The other characters are all considered as "insns"
 					breakSign = s
@@ -206,8 +219,9 @@ func ReadLst(
 			}
 		}
 		if dataDirectives[breakSign] {
-			// Not really insn, it is a data piece.
-			// Ignore it for now
+			// Not really insn, it is a data piece (e.g. switch tables after npad).
+			funcMap[fName].AddData(insnOffset, insnBytes, breakSign, codeLabelRefs(pieces[1:]))
+			lastIsAlign = false
 			continue
 		}
 		if _, ok := objx86coff.PrefixMap[lastPiece]; ok {
@@ -225,11 +239,15 @@ func ReadLst(
 				)
 			}
 			var isAlign bool
+			var align string
 			if breakSign == "npad" {
 				// It is a nop
+				align = strings.Join(pieces, " ")
 				if lastIsAlign {
 					// Append to the last nop
-					funcMap[fName].InsnAry[len(funcMap[fName].InsnAry)-1].Length += insnBytes
+					lastInsn := &funcMap[fName].InsnAry[len(funcMap[fName].InsnAry)-1]
+					lastInsn.Length += insnBytes
+					lastInsn.Align += "; " + align
 					continue
 				}
 				isAlign = true
@@ -245,6 +263,10 @@ func ReadLst(
 						IsAlign: isAlign,
 						Label:   lName,
 						Index:   labelIndex,
+						Align:   align,
+						File:    locFile,
+						Line:    locLine,
+						LstLine: insnLine,
 					},
 				)
 				labelIndex++
@@ -264,12 +286,44 @@ func ReadLst(
 				removeLabel++
 			}
 		}
+		funcMap[f].TailAligns = v.InsnAry[len(v.InsnAry)-removeInsn:]
 		funcMap[f].InsnAry = funcMap[f].InsnAry[:len(v.InsnAry)-removeInsn]
 		funcMap[f].LabelAry = funcMap[f].LabelAry[:len(funcMap[f].LabelAry)-removeLabel]
 	}
 	return
 }
 
+// sourceLineComment returns the source line number in comments of the forms
+// "; Line 12" and "; 12   :	source code"
+func sourceLineComment(fields []string) (lineNumber int, ok bool) {
+	if len(fields) < 3 || fields[0] != ";" {
+		return
+	}
+	numberField := fields[2]
+	if fields[1] != "Line" {
+		if fields[2] != ":" {
+			return
+		}
+		numberField = fields[1]
+	}
+	lineNumber64, err := strconv.ParseInt(numberField, 10, 64)
+	if err != nil {
+		return
+	}
+	return int(lineNumber64), true
+}
+
+// codeLabelPattern matches labels generated by cl, e.g. $LN5@func
+var codeLabelPattern = regexp.MustCompile(`\$[A-Za-z]+[0-9]+@[^\s,+\[\]]+`)
+
+// codeLabelRefs returns the code labels referenced in the pieces of a line
+func codeLabelRefs(pieces []string) (refs []string) {
+	for _, piece := range pieces {
+		refs = append(refs, codeLabelPattern.FindAllString(piece, -1)...)
+	}
+	return
+}
+
 // CheckMultipleEncoding in windows should not have multiple encoding cases
 func CheckMultipleEncoding(insn pstruct.InstFlags, lstInsnSize int) bool {
 	return false
@@ -0,0 +1,548 @@
+package coffutils
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	gtutils "github.com/pangine/disasm-gt-generator/gtutils"
+)
+
+// PDB streams
+const (
+	pdbStreamInfo = 1
+	pdbStreamTpi  = 2
+	pdbStreamDbi  = 3
+	pdbStreamIpi  = 4
+)
+
+// CodeView type and symbol record kinds
+const (
+	lfModifier  = 0x1001
+	lfPointer   = 0x1002
+	lfProcedure = 0x1008
+	lfMFunction = 0x1009
+	lfArgList   = 0x1201
+	lfBitfield  = 0x1205
+	lfArray     = 0x1503
+	lfClass     = 0x1504
+	lfStructure = 0x1505
+	lfUnion     = 0x1506
+	lfEnum      = 0x1507
+	lfInterface = 0x1519
+	lfFuncID    = 0x1601
+	lfMFuncID   = 0x1602
+
+	sLData32   = 0x110c
+	sGData32   = 0x110d
+	sLProc32   = 0x110f
+	sGProc32   = 0x1110
+	sLProc32ID = 0x1146
+	sGProc32ID = 0x1147
+)
+
+var msfMagic = []byte("Microsoft C/C++ MSF 7.00\r\n\x1aDS\x00\x00\x00")
+
+// cvSimpleTypes names the CodeView simple type kinds
+var cvSimpleTypes = map[int]string{
+	0x03: "void",
+	0x10: "int8", 0x20: "uint8", 0x68: "int8", 0x69: "uint8", 0x70: "int8", 0x7c: "uint8",
+	0x11: "int16", 0x21: "uint16", 0x72: "int16", 0x73: "uint16", 0x71: "uint16", 0x7a: "uint16",
+	0x12: "int32", 0x22: "uint32", 0x74: "int32", 0x75: "uint32", 0x7b: "uint32",
+	0x13: "int64", 0x23: "uint64", 0x76: "int64", 0x77: "uint64",
+	0x14: "int128", 0x24: "uint128", 0x78: "int128", 0x79: "uint128",
+	0x30: "bool", 0x31: "bool", 0x32: "bool", 0x33: "bool",
+	0x40: "float32", 0x41: "float64", 0x42: "float80", 0x43: "float128", 0x46: "float16",
+}
+
+// cvCallingConventions names the CV_call_e values
+var cvCallingConventions = map[int]string{
+	0x00: "cdecl",
+	0x02: "pascal",
+	0x04: "fastcall",
+	0x07: "stdcall",
+	0x09: "syscall",
+	0x0b: "thiscall",
+	0x16: "clrcall",
+	0x18: "vectorcall",
+}
+
+// msfFile reads the streams of a multi-stream file
+type msfFile struct {
+	data      []byte
+	blockSize int
+	sizes     []int
+	blocks    [][]int
+}
+
+// openMsf reads the stream directory of a PDB, nil if it is not a PDB
+func openMsf(data []byte) *msfFile {
+	if len(data) < 56 || !bytes.Equal(data[:len(msfMagic)], msfMagic) {
+		return nil
+	}
+	m := &msfFile{
+		data:      data,
+		blockSize: int(binary.LittleEndian.Uint32(data[32:])),
+	}
+	dirBytes := int(binary.LittleEndian.Uint32(data[44:]))
+	blockMap := int(binary.LittleEndian.Uint32(data[52:]))
+	if m.blockSize == 0 {
+		return nil
+	}
+	var dirBlocks []int
+	mapData := m.block(blockMap)
+	for i := 0; i < (dirBytes+m.blockSize-1)/m.blockSize && 4*i+4 <= len(mapData); i++ {
+		dirBlocks = append(dirBlocks, int(binary.LittleEndian.Uint32(mapData[4*i:])))
+	}
+	dir := m.read(dirBlocks, dirBytes)
+	if len(dir) < 4 {
+		return nil
+	}
+	count := int(binary.LittleEndian.Uint32(dir))
+	pos := 4
+	for i := 0; i < count && pos+4 <= len(dir); i++ {
+		size := int(binary.LittleEndian.Uint32(dir[pos:]))
+		if size == 0xffffffff {
+			size = 0
+		}
+		m.sizes = append(m.sizes, size)
+		pos += 4
+	}
+	for _, size := range m.sizes {
+		var blocks []int
+		for i := 0; i < (size+m.blockSize-1)/m.blockSize && pos+4 <= len(dir); i++ {
+			blocks = append(blocks, int(binary.LittleEndian.Uint32(dir[pos:])))
+			pos += 4
+		}
+		m.blocks = append(m.blocks, blocks)
+	}
+	return m
+}
+
+// block returns the data of a block
+func (m *msfFile) block(index int) []byte {
+	start := index * m.blockSize
+	if start < 0 || start+m.blockSize > len(m.data) {
+		return nil
+	}
+	return m.data[start : start+m.blockSize]
+}
+
+// read concatenates blocks up to size bytes
+func (m *msfFile) read(blocks []int, size int) []byte {
+	out := make([]byte, 0, size)
+	for _, b := range blocks {
+		out = append(out, m.block(b)...)
+	}
+	if len(out) > size {
+		out = out[:size]
+	}
+	return out
+}
+
+// stream returns the data of a stream
+func (m *msfFile) stream(index int) []byte {
+	if index < 0 || index >= len(m.sizes) {
+		return nil
+	}
+	return m.read(m.blocks[index], m.sizes[index])
+}
+
+// readTypeRecords indexes the records of a TPI or IPI stream
+func readTypeRecords(stream []byte) (records map[int][]byte) {
+	records = make(map[int][]byte)
+	if len(stream) < 12 {
+		return
+	}
+	headerSize := int(binary.LittleEndian.Uint32(stream[4:]))
+	index := int(binary.LittleEndian.Uint32(stream[8:]))
+	for pos := headerSize; pos+4 <= len(stream); index++ {
+		length := int(binary.LittleEndian.Uint16(stream[pos:]))
+		if length < 2 || pos+2+length > len(stream) {
+			break
+		}
+		records[index] = stream[pos+2 : pos+2+length]
+		pos += 2 + length
+	}
+	return
+}
+
+// pdbTypes resolves CodeView type indices
+type pdbTypes struct {
+	tpi  map[int][]byte
+	ipi  map[int][]byte
+	is64 bool
+}
+
+// record returns the kind and payload of a type record
+func (t *pdbTypes) record(records map[int][]byte, index int) (kind int, payload []byte) {
+	rec, ok := records[index]
+	if !ok || len(rec) < 2 {
+		return
+	}
+	return int(binary.LittleEndian.Uint16(rec)), rec[2:]
+}
+
+// typeRef normalizes a type index
+func (t *pdbTypes) typeRef(index int) (ref gtutils.TypeRef) {
+	ref.Base = "unspecified"
+	for depth := 0; depth < 32; depth++ {
+		if index < 0x1000 {
+			if (index>>8)&0xf != 0 {
+				ref.Pointer++
+			}
+			if name, ok := cvSimpleTypes[index&0xff]; ok {
+				ref.Base = name
+			}
+			return
+		}
+		kind, payload := t.record(t.tpi, index)
+		switch kind {
+		case lfPointer, lfModifier, lfBitfield:
+			if len(payload) < 4 {
+				return
+			}
+			if kind == lfPointer {
+				ref.Pointer++
+			}
+			index = int(binary.LittleEndian.Uint32(payload))
+			continue
+		case lfProcedure, lfMFunction:
+			ref.Base = "function"
+		case lfArray:
+			ref.Base = "array"
+		case lfClass, lfStructure, lfInterface:
+			ref.Base = "struct"
+		case lfUnion:
+			ref.Base = "union"
+		case lfEnum:
+			ref.Base = "enum"
+		}
+		return
+	}
+	return
+}
+
+// prototype resolves a procedure type, false if it is not one
+func (t *pdbTypes) prototype(index int) (proto gtutils.PrototypeRow, ok bool) {
+	kind, payload := t.record(t.tpi, index)
+	var rvType, thisType, callType, argList int
+	switch kind {
+	case lfProcedure:
+		if len(payload) < 12 {
+			return
+		}
+		rvType = int(binary.LittleEndian.Uint32(payload))
+		callType = int(payload[4])
+		argList = int(binary.LittleEndian.Uint32(payload[8:]))
+	case lfMFunction:
+		if len(payload) < 20 {
+			return
+		}
+		rvType = int(binary.LittleEndian.Uint32(payload))
+		thisType = int(binary.LittleEndian.Uint32(payload[8:]))
+		callType = int(payload[12])
+		argList = int(binary.LittleEndian.Uint32(payload[16:]))
+	default:
+		return
+	}
+	proto.Return = t.typeRef(rvType)
+	proto.Params = make([]gtutils.TypeRef, 0)
+	// The implicit this pointer, as DWARF lists it
+	if thisType != 0 {
+		proto.Params = append(proto.Params, t.typeRef(thisType))
+	}
+	if kind, args := t.record(t.tpi, argList); kind == lfArgList && len(args) >= 4 {
+		count := int(binary.LittleEndian.Uint32(args))
+		for i := 0; i < count && 8+4*i <= len(args); i++ {
+			arg := int(binary.LittleEndian.Uint32(args[4+4*i:]))
+			// A trailing T_NOTYPE marks variadic arguments
+			if arg == 0 && i == count-1 {
+				proto.Variadic = true
+				break
+			}
+			proto.Params = append(proto.Params, t.typeRef(arg))
+		}
+	}
+	proto.CallingConvention = fmt.Sprintf("call_%#x", callType)
+	if name, ok := cvCallingConventions[callType]; ok {
+		proto.CallingConvention = name
+	}
+	// All conventions but vectorcall are the Microsoft x64 one
+	if t.is64 && callType != 0x18 {
+		proto.CallingConvention = "win64"
+	}
+	return proto, true
+}
+
+// funcType maps an item id of a S_*PROC32_ID symbol to its type index
+func (t *pdbTypes) funcType(id int) int {
+	kind, payload := t.record(t.ipi, id)
+	if (kind == lfFuncID || kind == lfMFuncID) && len(payload) >= 8 {
+		return int(binary.LittleEndian.Uint32(payload[4:]))
+	}
+	return 0
+}
+
+// pdbModuleStreams lists the symbol streams of the modules in the DBI stream
+func pdbModuleStreams(dbi []byte) (streams []int, symBytes []int) {
+	if len(dbi) < 64 {
+		return
+	}
+	modInfoSize := int(binary.LittleEndian.Uint32(dbi[24:]))
+	end := 64 + modInfoSize
+	if end > len(dbi) {
+		end = len(dbi)
+	}
+	for pos := 64; pos+64 <= end; {
+		stream := int(binary.LittleEndian.Uint16(dbi[pos+34:]))
+		size := int(binary.LittleEndian.Uint32(dbi[pos+36:]))
+		if stream != 0xffff {
+			streams = append(streams, stream)
+			symBytes = append(symBytes, size)
+		}
+		// Module and object names follow the fixed fields
+		next := pos + 64
+		for n := 0; n < 2 && next < end; n++ {
+			zero := bytes.IndexByte(dbi[next:end], 0)
+			if zero < 0 {
+				return
+			}
+			next += zero + 1
+		}
+		pos = (next + 3) &^ 3
+	}
+	return
+}
+
+// pdbFile reads the symbols of the PDB of a binary
+type pdbFile struct {
+	msf       *msfFile
+	types     *pdbTypes
+	imageBase int
+	sections  []int // RVAs of the sections, by segment number - 1
+}
+
+// codeViewRecord reads the RSDS CodeView record of the debug directory of a
+// PE image: the PDB path, GUID and age the binary was linked with
+func codeViewRecord(f *pe.File) (path string, guid []byte, age uint32, ok bool) {
+	var dir pe.DataDirectory
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader64:
+		dir = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_DEBUG]
+	case *pe.OptionalHeader32:
+		dir = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_DEBUG]
+	default:
+		return
+	}
+	// rvaData returns the section data from rva
+	rvaData := func(rva uint32) []byte {
+		for _, sec := range f.Sections {
+			if rva < sec.VirtualAddress || rva >= sec.VirtualAddress+sec.VirtualSize {
+				continue
+			}
+			data, err := sec.Data()
+			if err != nil || int(rva-sec.VirtualAddress) >= len(data) {
+				return nil
+			}
+			return data[rva-sec.VirtualAddress:]
+		}
+		return nil
+	}
+	entries := rvaData(dir.VirtualAddress)
+	for pos := 0; pos+28 <= int(dir.Size) && pos+28 <= len(entries); pos += 28 {
+		if binary.LittleEndian.Uint32(entries[pos+12:]) != 2 {
+			// Not IMAGE_DEBUG_TYPE_CODEVIEW
+			continue
+		}
+		size := int(binary.LittleEndian.Uint32(entries[pos+16:]))
+		record := rvaData(binary.LittleEndian.Uint32(entries[pos+20:]))
+		if size < 25 || len(record) < size || string(record[:4]) != "RSDS" {
+			continue
+		}
+		record = record[:size]
+		path = string(record[24:])
+		if zero := strings.IndexByte(path, 0); zero >= 0 {
+			path = path[:zero]
+		}
+		return path, record[4:20], binary.LittleEndian.Uint32(record[20:]), true
+	}
+	return
+}
+
+// openPdb reads the PDB of the binary, nil if there is none. The PDB is the
+// one named in the CodeView debug directory, searched at its recorded path and
+// next to the binary, and must have the GUID and age the binary records.
+// Binaries without a CodeView record fall back to foo.pdb for foo.exe or
+// foo.dll.
+func openPdb(binFile string) *pdbFile {
+	f, err := pe.Open(binFile)
+	if err != nil {
+		fmt.Printf("\tWARNING: %s cannot be open as pe\n", binFile)
+		return nil
+	}
+	defer f.Close()
+	cvPath, guid, age, haveCv := codeViewRecord(f)
+	candidates := []string{strings.TrimSuffix(binFile, filepath.Ext(binFile)) + ".pdb"}
+	if haveCv {
+		// The recorded path is usually a Windows path
+		base := cvPath[strings.LastIndexAny(cvPath, "\\/")+1:]
+		candidates = []string{cvPath, filepath.Join(filepath.Dir(binFile), base), candidates[0]}
+	}
+	var m *msfFile
+	var pdbPath string
+	for _, candidate := range candidates {
+		data, err := ioutil.ReadFile(candidate)
+		if err != nil {
+			continue
+		}
+		pdbPath = candidate
+		if m = openMsf(data); m == nil {
+			fmt.Printf("\tWARNING: %s is not a PDB\n", pdbPath)
+			continue
+		}
+		// PDB info stream: version, signature, age, GUID
+		info := m.stream(pdbStreamInfo)
+		if haveCv && (len(info) < 28 ||
+			binary.LittleEndian.Uint32(info[8:]) != age ||
+			!bytes.Equal(info[12:28], guid)) {
+			fmt.Printf("\tWARNING: %s does not match the GUID and age recorded in %s\n", pdbPath, binFile)
+			m = nil
+			continue
+		}
+		break
+	}
+	if m == nil {
+		// No debug information
+		return nil
+	}
+	pdb := &pdbFile{
+		msf: m,
+		types: &pdbTypes{
+			tpi: readTypeRecords(m.stream(pdbStreamTpi)),
+			ipi: readTypeRecords(m.stream(pdbStreamIpi)),
+		},
+	}
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader64:
+		pdb.imageBase, pdb.types.is64 = int(oh.ImageBase), true
+	case *pe.OptionalHeader32:
+		pdb.imageBase = int(oh.ImageBase)
+	}
+	for _, sec := range f.Sections {
+		pdb.sections = append(pdb.sections, int(sec.VirtualAddress))
+	}
+	return pdb
+}
+
+// address converts a segment and offset to an image address
+func (pdb *pdbFile) address(seg, offset int) (addr int, ok bool) {
+	if seg < 1 || seg > len(pdb.sections) {
+		return
+	}
+	return pdb.imageBase + pdb.sections[seg-1] + offset, true
+}
+
+// symbols visits the records of the global symbol stream and the module
+// symbol streams
+func (pdb *pdbFile) symbols(visit func(kind int, rec []byte)) {
+	walk := func(syms []byte, pos int) {
+		for pos+4 <= len(syms) {
+			length := int(binary.LittleEndian.Uint16(syms[pos:]))
+			if length < 2 || pos+2+length > len(syms) {
+				return
+			}
+			visit(int(binary.LittleEndian.Uint16(syms[pos+2:])), syms[pos+4:pos+2+length])
+			pos += 2 + length
+		}
+	}
+	dbi := pdb.msf.stream(pdbStreamDbi)
+	if len(dbi) >= 22 {
+		walk(pdb.msf.stream(int(binary.LittleEndian.Uint16(dbi[20:]))), 0)
+	}
+	streams, symBytes := pdbModuleStreams(dbi)
+	for i, stream := range streams {
+		syms := pdb.msf.stream(stream)
+		if symBytes[i] < len(syms) {
+			syms = syms[:symBytes[i]]
+		}
+		// Skip the signature
+		walk(syms, 4)
+	}
+}
+
+// CoffPrototypes reads the prototypes of the functions in funcs from the
+// procedure type records of the PDB next to the binary
+func CoffPrototypes(binFile string, funcs map[gtutils.FuncRow][]int) (prototypes []gtutils.PrototypeRow) {
+	pdb := openPdb(binFile)
+	if pdb == nil {
+		return
+	}
+	isFuncStart := make(map[int]bool)
+	for fr := range funcs {
+		isFuncStart[fr.Start] = true
+	}
+	found := make(map[int]bool)
+	pdb.symbols(func(kind int, rec []byte) {
+		if kind != sGProc32 && kind != sLProc32 && kind != sGProc32ID && kind != sLProc32ID {
+			return
+		}
+		if len(rec) < 34 {
+			return
+		}
+		typeIndex := int(binary.LittleEndian.Uint32(rec[24:]))
+		start, ok := pdb.address(int(binary.LittleEndian.Uint16(rec[32:])), int(binary.LittleEndian.Uint32(rec[28:])))
+		if !ok || !isFuncStart[start] || found[start] {
+			return
+		}
+		if kind == sGProc32ID || kind == sLProc32ID {
+			typeIndex = pdb.types.funcType(typeIndex)
+		}
+		proto, ok := pdb.types.prototype(typeIndex)
+		if !ok {
+			return
+		}
+		found[start] = true
+		proto.FuncStart = start
+		prototypes = append(prototypes, proto)
+	})
+	sort.Slice(prototypes, func(i, j int) bool {
+		return prototypes[i].FuncStart < prototypes[j].FuncStart
+	})
+	return
+}
+
+// CoffDataTypes sets the types of data objects from the S_GDATA32 and
+// S_LDATA32 records of the PDB next to the binary
+func CoffDataTypes(binFile string, objects []gtutils.DataObjectRow) {
+	pdb := openPdb(binFile)
+	if pdb == nil {
+		return
+	}
+	types := make(map[int]gtutils.TypeRef)
+	pdb.symbols(func(kind int, rec []byte) {
+		if kind != sGData32 && kind != sLData32 {
+			return
+		}
+		if len(rec) < 10 {
+			return
+		}
+		addr, ok := pdb.address(int(binary.LittleEndian.Uint16(rec[8:])), int(binary.LittleEndian.Uint32(rec[4:])))
+		if !ok {
+			return
+		}
+		if _, ok := types[addr]; !ok {
+			types[addr] = pdb.types.typeRef(int(binary.LittleEndian.Uint32(rec)))
+		}
+	})
+	for i := range objects {
+		if t, ok := types[objects[i].Start]; ok {
+			objects[i].Type = &t
+		}
+	}
+}
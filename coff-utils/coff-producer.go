@@ -0,0 +1,138 @@
+package coffutils
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	gtutils "github.com/pangine/disasm-gt-generator/gtutils"
+)
+
+// compIDProducer formats an MSVC @comp.id or Rich header product id
+func compIDProducer(compID int) string {
+	return fmt.Sprintf("prodid %d build %d", compID>>16, compID&0xffff)
+}
+
+// richEntries decodes the Rich header in the DOS stub of an image
+func richEntries(image []byte) (producers []string) {
+	if len(image) < 0x40 {
+		return
+	}
+	peOffset := int(binary.LittleEndian.Uint32(image[0x3c:]))
+	if peOffset > len(image) {
+		peOffset = len(image)
+	}
+	rich := bytes.Index(image[:peOffset], []byte("Rich"))
+	if rich < 0 || rich+8 > len(image) {
+		return
+	}
+	key := binary.LittleEndian.Uint32(image[rich+4:])
+	dans := -1
+	for pos := rich - 4; pos >= 0; pos -= 4 {
+		if binary.LittleEndian.Uint32(image[pos:])^key == 0x536e6144 {
+			// "DanS"
+			dans = pos
+			break
+		}
+	}
+	if dans < 0 {
+		return
+	}
+	// 3 padding dwords follow "DanS"
+	for pos := dans + 16; pos+8 <= rich; pos += 8 {
+		compID := int(binary.LittleEndian.Uint32(image[pos:]) ^ key)
+		count := int(binary.LittleEndian.Uint32(image[pos+4:]) ^ key)
+		for i := 0; i < count; i++ {
+			producers = append(producers, compIDProducer(compID))
+		}
+	}
+	return
+}
+
+// objProducer reads @comp.id and the compiler command line in .debug$S of an object
+func objProducer(objFile string) (producer string) {
+	f, err := pe.Open(objFile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	for _, s := range f.Symbols {
+		if s.Name == "@comp.id" {
+			producer = compIDProducer(int(s.Value))
+			break
+		}
+	}
+	if producer == "" {
+		return
+	}
+	for _, sec := range f.Sections {
+		if sec.Name != ".debug$S" {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			continue
+		}
+		// S_ENVBLOCK stores pairs of zero terminated strings, including "cmd"
+		idx := bytes.Index(data, []byte("\x00cmd\x00"))
+		if idx < 0 {
+			continue
+		}
+		cmd := data[idx+5:]
+		if end := bytes.IndexByte(cmd, 0); end >= 0 {
+			cmd = cmd[:end]
+		}
+		producer += " " + string(cmd)
+		break
+	}
+	return
+}
+
+// CoffProducers reads the compilers of a coff binary from its Rich header,
+// and assigns every function the @comp.id and command line of its object
+func CoffProducers(
+	binFile, objDir string,
+	symbolFuncs []gtutils.SymbolFuncInfo,
+	funcs map[gtutils.FuncRow][]int,
+) (metadata []gtutils.MetadataRow, producers map[int]string) {
+	producers = make(map[int]string)
+	image, err := ioutil.ReadFile(binFile)
+	if err != nil {
+		fmt.Printf("\tWARNING: %s cannot be read, producers are not resolved\n", binFile)
+		return
+	}
+	metadata = gtutils.CountProducers("rich", richEntries(image))
+
+	sources := make(map[int]string)
+	for _, s := range symbolFuncs {
+		sources[s.Offset] = s.Source
+	}
+	objProducers := make(map[string]string)
+	for fr := range funcs {
+		source := sources[fr.Start]
+		if source == "" || strings.Index(source, ":") >= 0 {
+			// Library objects are not available
+			continue
+		}
+		producer, ok := objProducers[source]
+		if !ok {
+			producer = objProducer(filepath.Join(objDir, source))
+			objProducers[source] = producer
+		}
+		if producer != "" {
+			producers[fr.Start] = producer
+		}
+	}
+	objList := make([]string, 0, len(objProducers))
+	for _, p := range objProducers {
+		if p != "" {
+			objList = append(objList, p)
+		}
+	}
+	metadata = append(metadata, gtutils.CountProducers("comp.id", objList)...)
+	return
+}
@@ -0,0 +1,166 @@
+package coffutils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	gtutils "github.com/pangine/disasm-gt-generator/gtutils"
+	pstruct "github.com/pangine/pangineDSM-utils/program-struct"
+)
+
+// cstring reads a zero terminated string at rva
+func (img *peImage) cstring(rva int) string {
+	data := img.bytesAt(rva)
+	if end := strings.IndexByte(string(data), 0); end >= 0 {
+		return string(data[:end])
+	}
+	return string(data)
+}
+
+// importSlots reads the import directory and returns the names of the
+// imported functions keyed by the addresses of their IAT slots
+func (img *peImage) importSlots() (slots map[int]string) {
+	slots = make(map[int]string)
+	if img.imports == 0 {
+		return
+	}
+	for desc := img.imports; ; desc += 20 {
+		lookup, _ := img.u32(desc)
+		dllName, _ := img.u32(desc + 12)
+		iat, ok := img.u32(desc + 16)
+		if !ok || iat == 0 {
+			break
+		}
+		if lookup == 0 {
+			lookup = iat
+		}
+		dll := img.cstring(dllName)
+		for i := 0; ; i++ {
+			entry := img.bytesAt(lookup + i*img.ptrSize)
+			if len(entry) < img.ptrSize {
+				break
+			}
+			var value uint64
+			var byOrdinal bool
+			if img.ptrSize == 8 {
+				value = binary.LittleEndian.Uint64(entry)
+				byOrdinal = value&(1<<63) != 0
+			} else {
+				value = uint64(binary.LittleEndian.Uint32(entry))
+				byOrdinal = value&(1<<31) != 0
+			}
+			if value == 0 {
+				break
+			}
+			var name string
+			if byOrdinal {
+				name = fmt.Sprintf("%s!#%d", dll, value&0xffff)
+			} else {
+				// Skip the hint
+				name = img.cstring(int(value&0x7fffffff) + 2)
+			}
+			slots[img.imageBase+iat+i*img.ptrSize] = name
+		}
+	}
+	return
+}
+
+// CoffLinkerStubs finds the linker generated stubs among the symbols that have
+// no listing: incremental linking thunks (@ILT) and import jump stubs through
+// the IAT
+func CoffLinkerStubs(
+	binFile string,
+	bi pstruct.BinaryInfo,
+	noListing []gtutils.SymbolFuncInfo,
+) (stubs []gtutils.CodeRange) {
+	img := openPeImage(binFile)
+	if img == nil {
+		fmt.Printf("\tWARNING: %s cannot be open as pe, linker stubs are not resolved\n", binFile)
+		return
+	}
+	iatSlots := img.importSlots()
+	for _, s := range noListing {
+		if !pstruct.VAisValid(bi.ProgramHeaders, s.Offset) {
+			continue
+		}
+		phy := pstruct.V2PConv(bi.ProgramHeaders, s.Offset)
+		if phy < 0 || phy+7 > len(bi.Sections.Data) {
+			continue
+		}
+		code := bi.Sections.Data[phy : phy+7]
+		if strings.HasPrefix(s.Function, "@ILT+") && code[0] == 0xe9 {
+			// jmp rel32 to the real function
+			stubs = append(stubs, gtutils.CodeRange{
+				Name:  s.Function,
+				Start: s.Offset,
+				End:   s.Offset + 5,
+			})
+			continue
+		}
+		// jmp [__imp_X], may have a REX.W prefix
+		jmpAt := 0
+		if code[0] == 0x48 {
+			jmpAt = 1
+		}
+		if code[jmpAt] != 0xff || code[jmpAt+1] != 0x25 {
+			continue
+		}
+		size := jmpAt + 6
+		slot := int(int32(binary.LittleEndian.Uint32(code[jmpAt+2:])))
+		if img.ptrSize == 8 {
+			slot += s.Offset + size
+		}
+		if _, ok := iatSlots[slot]; !ok {
+			continue
+		}
+		stubs = append(stubs, gtutils.CodeRange{
+			Name:  s.Function,
+			Start: s.Offset,
+			End:   s.Offset + size,
+		})
+	}
+	return
+}
+
+// ImportRefs finds the memory indirect calls and jumps through the IAT
+// (call [__imp_X] and jmp [__imp_X]). It returns the imported names keyed by
+// IAT slot, and the slot used by each of these instructions.
+func ImportRefs(
+	binFile string,
+	bi pstruct.BinaryInfo,
+	insts map[int]gtutils.InsnSupplementary,
+) (names map[int]string, slotRefs map[int]int) {
+	slotRefs = make(map[int]int)
+	img := openPeImage(binFile)
+	if img == nil {
+		fmt.Printf("\tWARNING: %s cannot be open as pe, imported calls are not resolved\n", binFile)
+		return
+	}
+	names = img.importSlots()
+	for offset, supplementary := range insts {
+		if supplementary.Class != gtutils.ClassIndirect {
+			continue
+		}
+		phy := pstruct.V2PConv(bi.ProgramHeaders, offset)
+		if phy < 0 || phy+supplementary.Length > len(bi.Sections.Data) {
+			continue
+		}
+		code := bi.Sections.Data[phy : phy+supplementary.Length]
+		// ff 15/ff 25 disp32, may have a REX.W prefix
+		if len(code) > 0 && code[0] == 0x48 {
+			code = code[1:]
+		}
+		if len(code) != 6 || code[0] != 0xff || (code[1] != 0x15 && code[1] != 0x25) {
+			continue
+		}
+		slot := int(int32(binary.LittleEndian.Uint32(code[2:])))
+		if img.ptrSize == 8 {
+			slot += offset + supplementary.Length
+		}
+		if _, ok := names[slot]; ok {
+			slotRefs[offset] = slot
+		}
+	}
+	return
+}
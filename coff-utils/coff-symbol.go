@@ -2,6 +2,7 @@ package coffutils
 
 import (
 	"bufio"
+	"debug/pe"
 	"fmt"
 	"os"
 	"os/exec"
@@ -111,6 +112,102 @@ func resolveMap(fin string) (fmap []gtutils.SymbolFuncInfo, loadBase int) {
 	return
 }
 
+// ResolveDataObjects extracts the data symbols (entries without the "f" flag)
+// of the map file that are in data sections of the binary
+func ResolveDataObjects(mapfile, binFile string) (objects []gtutils.DataObjectRow) {
+	objects = make([]gtutils.DataObjectRow, 0)
+	f, err := pe.Open(binFile)
+	if err != nil {
+		fmt.Printf("\tWARNING: %s cannot be open as pe, data objects are not resolved\n", binFile)
+		return
+	}
+	defer f.Close()
+	bin, finerr := os.Open(mapfile)
+	if finerr != nil {
+		fmt.Printf("\tFATAL: %s cannot be open\n", mapfile)
+		panic(finerr)
+	}
+	defer bin.Close()
+
+	var inSymbolTbl bool
+	seen := make(map[int]bool)
+	lines := bufio.NewScanner(bin)
+	for lines.Scan() {
+		fields := strings.Fields(lines.Text())
+		if len(fields) >= 6 &&
+			fields[0] == "Address" &&
+			fields[1] == "Publics" {
+			inSymbolTbl = true
+			continue
+		}
+		if !inSymbolTbl || len(fields) < 4 {
+			continue
+		}
+		secOff := strings.Split(fields[0], ":")
+		if len(secOff) != 2 {
+			continue
+		}
+		var isFunction bool
+		for i := 3; i < len(fields); i++ {
+			if fields[i] == "f" {
+				isFunction = true
+				break
+			}
+		}
+		if isFunction {
+			continue
+		}
+		sec64, err := strconv.ParseInt(secOff[0], 16, 64)
+		if err != nil || sec64 < 1 || int(sec64) > len(f.Sections) {
+			// Absolute symbols
+			continue
+		}
+		sec := f.Sections[sec64-1]
+		if sec.Characteristics&pe.IMAGE_SCN_MEM_EXECUTE != 0 {
+			continue
+		}
+		memoryAddr64, err := strconv.ParseInt(fields[2], 16, 64)
+		if err != nil {
+			panic(err)
+		}
+		if seen[int(memoryAddr64)] {
+			continue
+		}
+		seen[int(memoryAddr64)] = true
+		objects = append(objects, gtutils.DataObjectRow{
+			Name:    fields[1],
+			Start:   int(memoryAddr64),
+			Section: sec.Name,
+		})
+	}
+
+	// The map file has no sizes, assume that objects extend to the next one
+	// or the end of their section
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Start < objects[j].Start
+	})
+	var loadBase int
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader64:
+		loadBase = int(oh.ImageBase)
+	case *pe.OptionalHeader32:
+		loadBase = int(oh.ImageBase)
+	}
+	for i := range objects {
+		for _, sec := range f.Sections {
+			if sec.Name == objects[i].Section {
+				objects[i].Size = loadBase + int(sec.VirtualAddress+sec.VirtualSize) - objects[i].Start
+				break
+			}
+		}
+		if i+1 < len(objects) && objects[i+1].Section == objects[i].Section &&
+			objects[i+1].Start-objects[i].Start < objects[i].Size {
+			objects[i].Size = objects[i+1].Start - objects[i].Start
+		}
+	}
+	return
+}
+
 type sectionRange struct {
 	name  string
 	start int
@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,6 +18,7 @@ import (
 	gtutils "github.com/pangine/disasm-gt-generator/gtutils"
 	objx86elf "github.com/pangine/pangineDSM-obj-x86-elf"
 	genutils "github.com/pangine/pangineDSM-utils/general"
+	pstruct "github.com/pangine/pangineDSM-utils/program-struct"
 )
 
 type instRoot struct {
@@ -25,6 +27,10 @@ type instRoot struct {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrate(os.Args[2:])
+		return
+	}
 	argNum := len(os.Args)
 	InputDir := os.Args[argNum-1]
 
@@ -35,6 +41,7 @@ func main() {
 	noCheckFuncSizeFlag := flag.Bool("ncfs", false, "do not check function size when matching")
 	rvlISAFlag := flag.String("ra", "", "specify a ISA to start llvmmc-resolver (by default it will be auto detected according to input llvm triple)")
 	printFlag := flag.Bool("print", false, "Print supported llvm triple types for this program")
+	libFlag := flag.String("lib", "", "a directory of library object files (.o/.obj) to match code without listings, e.g. CRT and static libraries")
 	flag.Parse()
 	llvmTriple := *ltFlag
 	singleDir := *singleDirFlag
@@ -43,6 +50,7 @@ func main() {
 	noCheckFuncSize := *noCheckFuncSizeFlag
 	rvlISA := *rvlISAFlag
 	printLLVM := *printFlag
+	libDir := *libFlag
 
 	if printLLVM {
 		genutils.PrintSupportLlvmTriple(gtutils.LLVMTriples)
@@ -70,6 +78,23 @@ func main() {
 	var cntDisc int
 	osEnvObj := llvmTripleStruct.OS + "-" + llvmTripleStruct.Env + "-" + llvmTripleStruct.Obj
 
+	var libFuncs gtutils.LibraryIndex
+	switch osEnvObj {
+	case "Linux-GNU-ELF":
+		libFuncs = elfutils.ReadLibraryObjects(libDir)
+	case "Win32-MSVC-COFF":
+		libFuncs = coffutils.ReadLibraryObjects(libDir)
+	}
+
+	// Options recorded in the meta table of every ground truth
+	options := map[string]string{
+		"ncfs": strconv.FormatBool(noCheckFuncSize),
+		"g":    strconv.FormatBool(gnuPrefix),
+		"lib":  libDir,
+		// Aggressive root search is always on for now
+		"aggressive": "true",
+	}
+
 	if rvlISA == "" {
 		rvlISA = llvmTripleStruct.Arch
 	}
@@ -137,6 +162,9 @@ func main() {
 			fmt.Println("\t++++++++++ground truth matching++++++++++")
 			var insts map[int]gtutils.InsnSupplementary
 			var funcs map[gtutils.FuncRow][]int
+			var extra gtutils.GtExtra
+			var dataObjects []gtutils.DataObjectRow
+			var bi pstruct.BinaryInfo
 			var failure bool
 
 			switch osEnvObj {
@@ -144,14 +172,17 @@ func main() {
 				symFile := filepath.Join(refDir, file+".sym")
 				symbols := elfutils.GenSymbol(binFile, symFile, gnuPrefix)
 				symbolFuncs := elfutils.SymbolResolve(symbols)
-				bi := objx86elf.ObjectElf{}.ParseObj(binFile)
-				insts, funcs, failure = elfutils.ElfGroundtruthMatch(
+				dataObjects = elfutils.DataObjectResolve(symbols)
+				elfutils.ElfDataTypes(binFile, dataObjects)
+				bi = objx86elf.ObjectElf{}.ParseObj(binFile)
+				insts, funcs, extra, failure = elfutils.ElfGroundtruthMatch(
 					asmDir,
 					objDir,
 					mthFile,
-					file,
+					binFile,
 					symbolFuncs,
 					aoMap,
+					libFuncs,
 					bi,
 					llvmTripleStruct,
 					gnuPrefix,
@@ -161,14 +192,17 @@ func main() {
 				mapFile := filepath.Join(refDir, strings.TrimSuffix(file, ".exe")+".map")
 				dumpbinFile := filepath.Join(refDir, strings.TrimSuffix(file, ".exe")+".dumpbin.out")
 				symbolFuncs := coffutils.ResolveSymbols(mapFile, dumpbinFile)
-				bi := objx86coff.ObjectCoff{}.ParseObj(binFile)
-				insts, funcs, failure = coffutils.CoffGroundtruthMatch(
+				dataObjects = coffutils.ResolveDataObjects(mapFile, binFile)
+				coffutils.CoffDataTypes(binFile, dataObjects)
+				bi = objx86coff.ObjectCoff{}.ParseObj(binFile)
+				insts, funcs, extra, failure = coffutils.CoffGroundtruthMatch(
 					asmDir,
 					objDir,
 					mthFile,
-					file,
+					binFile,
 					symbolFuncs,
 					aoMap,
+					libFuncs,
 					bi,
 					llvmTripleStruct,
 					noCheckFuncSize,
@@ -181,11 +215,21 @@ func main() {
 				continue
 			}
 			cntSucc++
+			extra.DataObjects = dataObjects
+			extra.Meta = gtutils.GtMeta{
+				Triple:     llvmTriple,
+				BinaryHash: gtutils.FileSHA256(binFile),
+				Inputs:     gtutils.InputHashes(asmDir, objDir, aoMap),
+				Options:    options,
+				Timestamp:  time.Now(),
+				// Set by the format specific matching
+				Unsupported: extra.Meta.Unsupported,
+			}
 
 			fmt.Println("\t++++++++++ground truth generating++++++++++")
 
 			refFile := filepath.Join(gtDir, file+".sqlite")
-			gtutils.CreateSqliteGt(refFile, insts, funcs)
+			gtutils.CreateSqliteGt(refFile, insts, funcs, extra, bi)
 			fmt.Println("\t++++++++++done++++++++++")
 		}
 	}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	gtutils "github.com/pangine/disasm-gt-generator/gtutils"
+	objx86coff "github.com/pangine/pangineDSM-obj-x86-coff"
+	objx86elf "github.com/pangine/pangineDSM-obj-x86-elf"
+	genutils "github.com/pangine/pangineDSM-utils/general"
+	objectapi "github.com/pangine/pangineDSM-utils/objectAPI"
+	pstruct "github.com/pangine/pangineDSM-utils/program-struct"
+)
+
+// migrate upgrades existing ground truth databases to the current schema.
+//
+//	disasm-gt migrate [-l triple] [-o out.sqlite] file.sqlite binary
+//	disasm-gt migrate [-l triple] [-o outRoot] [-sd dir] InputDir
+//
+// The second form migrates InputDir/gt/<dir>/<file>.sqlite against
+// InputDir/bin/<dir>/<file>. Without -o databases are upgraded in place.
+func migrate(args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	ltFlag := flags.String("l", "x86_64-PC-Linux-GNU-ELF", "the llvm triple for the target binaries")
+	outFlag := flags.String("o", "", "write the upgraded databases to this file (or root directory) instead of in place")
+	singleDirFlag := flags.String("sd", "", "only operate on a single dir")
+	rvlISAFlag := flags.String("ra", "", "specify a ISA to start llvmmc-resolver (by default it will be auto detected according to input llvm triple)")
+	flags.Parse(args)
+	llvmTriple := *ltFlag
+	out := *outFlag
+	singleDir := *singleDirFlag
+	rvlISA := *rvlISAFlag
+
+	llvmTripleStruct := genutils.ParseLlvmTriple(genutils.CheckLlvmTriple(llvmTriple, gtutils.LLVMTriples))
+	osEnvObj := llvmTripleStruct.OS + "-" + llvmTripleStruct.Env + "-" + llvmTripleStruct.Obj
+
+	// Pairs of databases and the binaries they are generated from
+	type target struct {
+		gtFile, binFile, outFile string
+	}
+	var targets []target
+	switch flags.NArg() {
+	case 2:
+		t := target{gtFile: flags.Arg(0), binFile: flags.Arg(1), outFile: flags.Arg(0)}
+		if out != "" {
+			t.outFile = out
+		}
+		targets = append(targets, t)
+	case 1:
+		binRoot := filepath.Join(flags.Arg(0), "bin")
+		gtRoot := filepath.Join(flags.Arg(0), "gt")
+		outRoot := gtRoot
+		if out != "" {
+			outRoot = out
+		}
+		var dirList []string
+		if singleDir != "" {
+			dirList = []string{singleDir}
+		} else {
+			dirList = genutils.GetDirs(gtRoot)
+		}
+		for _, dir := range dirList {
+			_ = os.MkdirAll(filepath.Join(outRoot, dir), os.ModePerm)
+			for _, gt := range genutils.GetFiles(filepath.Join(gtRoot, dir), ".sqlite") {
+				targets = append(targets, target{
+					gtFile:  filepath.Join(gtRoot, dir, gt),
+					binFile: filepath.Join(binRoot, dir, strings.TrimSuffix(gt, ".sqlite")),
+					outFile: filepath.Join(outRoot, dir, gt),
+				})
+			}
+		}
+	default:
+		fmt.Println("usage: disasm-gt migrate [-l triple] [-o out] (file.sqlite binary | InputDir)")
+		os.Exit(2)
+	}
+
+	var obj objectapi.Object
+	switch osEnvObj {
+	case "Linux-GNU-ELF":
+		obj = objx86elf.ObjectElf{}
+	case "Win32-MSVC-COFF":
+		obj = objx86coff.ObjectCoff{}
+	}
+
+	if rvlISA == "" {
+		rvlISA = llvmTripleStruct.Arch
+	}
+	fmt.Println("Start llvmmc-resolver...")
+	resolver := exec.Command("resolver", "-p", rvlISA)
+	resolver.Start()
+	time.Sleep(time.Second)
+
+	var cntSucc, cntFail int
+	for _, t := range targets {
+		fmt.Printf("%s\n", t.gtFile)
+		if _, err := os.Stat(t.binFile); err != nil {
+			fmt.Printf("\tERROR: binary %s does not exist\n", t.binFile)
+			cntFail++
+			continue
+		}
+		if t.outFile != t.gtFile {
+			// Migrate a copy, the original is left as it is
+			if err := copyFile(t.gtFile, t.outFile); err != nil {
+				fmt.Printf("\tFATAL: %s cannot be copied to %s\n", t.gtFile, t.outFile)
+				panic(err)
+			}
+		}
+		var bi pstruct.BinaryInfo
+		switch osEnvObj {
+		case "Linux-GNU-ELF":
+			bi = objx86elf.ObjectElf{}.ParseObj(t.binFile)
+		case "Win32-MSVC-COFF":
+			bi = objx86coff.ObjectCoff{}.ParseObj(t.binFile)
+		}
+		if gtutils.MigrateSqliteGt(t.outFile, t.binFile, llvmTriple, bi, obj) {
+			if t.outFile != t.gtFile {
+				os.Remove(t.outFile)
+			}
+			cntFail++
+			continue
+		}
+		cntSucc++
+	}
+	fmt.Printf("Succeed: %d, Failed: %d\n", cntSucc, cntFail)
+	resolver.Process.Kill()
+}
+
+// copyFile copies src to dst, which is created or truncated
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,69 @@
+package elfutils
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+
+	gtutils "github.com/pangine/disasm-gt-generator/gtutils"
+)
+
+// DW_OP_addr
+const dwOpAddr = 0x03
+
+// ElfDataTypes sets the types of data objects from DWARF DW_TAG_variable
+// entries located at a static address
+func ElfDataTypes(binFile string, objects []gtutils.DataObjectRow) {
+	f, err := elf.Open(binFile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	d, err := f.DWARF()
+	if err != nil {
+		// No debug information
+		return
+	}
+	addrSize := 4
+	if f.Class == elf.ELFCLASS64 {
+		addrSize = 8
+	}
+	types := make(map[int]gtutils.TypeRef)
+	r := d.Reader()
+	for {
+		e, err := r.Next()
+		if err != nil || e == nil {
+			break
+		}
+		if e.Tag != dwarf.TagVariable {
+			continue
+		}
+		loc, ok := e.Val(dwarf.AttrLocation).([]byte)
+		if !ok || len(loc) != 1+addrSize || loc[0] != dwOpAddr {
+			continue
+		}
+		var addr int
+		if addrSize == 8 {
+			addr = int(f.ByteOrder.Uint64(loc[1:]))
+		} else {
+			addr = int(f.ByteOrder.Uint32(loc[1:]))
+		}
+		if _, ok := types[addr]; ok {
+			continue
+		}
+		// Definitions of C++ static members keep the type in their declarations
+		typed := e
+		if _, ok := e.Val(dwarf.AttrType).(dwarf.Offset); !ok {
+			if ref, ok := e.Val(dwarf.AttrSpecification).(dwarf.Offset); ok {
+				if decl := dwarfEntryAt(d, ref); decl != nil {
+					typed = decl
+				}
+			}
+		}
+		types[addr] = dwarfTypeRef(d, typed)
+	}
+	for i := range objects {
+		if t, ok := types[objects[i].Start]; ok {
+			objects[i].Type = &t
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package elfutils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	gtutils "github.com/pangine/disasm-gt-generator/gtutils"
+)
+
+// DWARF exception header pointer encodings
+const (
+	ehPeAbsptr   = 0x00
+	ehPeUleb128  = 0x01
+	ehPeUdata2   = 0x02
+	ehPeUdata4   = 0x03
+	ehPeUdata8   = 0x04
+	ehPeSleb128  = 0x09
+	ehPeSdata2   = 0x0a
+	ehPeSdata4   = 0x0b
+	ehPeSdata8   = 0x0c
+	ehPePcrel    = 0x10
+	ehPeIndirect = 0x80
+	ehPeOmit     = 0xff
+)
+
+// ehReader reads exception handling data of a section loaded at addr
+type ehReader struct {
+	data    []byte
+	addr    int
+	pos     int
+	order   binary.ByteOrder
+	ptrSize int
+}
+
+func (r *ehReader) eof() bool {
+	return r.pos >= len(r.data)
+}
+
+func (r *ehReader) u8() int {
+	if r.eof() {
+		return 0
+	}
+	r.pos++
+	return int(r.data[r.pos-1])
+}
+
+func (r *ehReader) fixed(size int, signed bool) int {
+	if r.pos+size > len(r.data) {
+		r.pos = len(r.data)
+		return 0
+	}
+	data := r.data[r.pos : r.pos+size]
+	r.pos += size
+	if signed {
+		return readSigned(data, size, r.order)
+	}
+	switch size {
+	case 8:
+		return int(r.order.Uint64(data))
+	case 4:
+		return int(r.order.Uint32(data))
+	case 2:
+		return int(r.order.Uint16(data))
+	}
+	return int(data[0])
+}
+
+func (r *ehReader) uleb() (value int) {
+	for shift := uint(0); !r.eof(); shift += 7 {
+		b := r.u8()
+		value |= (b & 0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	return
+}
+
+func (r *ehReader) sleb() (value int) {
+	var shift uint
+	var b int
+	for !r.eof() {
+		b = r.u8()
+		value |= (b & 0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if shift < 64 && b&0x40 != 0 {
+		value |= -1 << shift
+	}
+	return
+}
+
+func (r *ehReader) cstring() string {
+	start := r.pos
+	for !r.eof() && r.data[r.pos] != 0 {
+		r.pos++
+	}
+	str := string(r.data[start:r.pos])
+	r.pos++
+	return str
+}
+
+// encoded reads a pointer with encoding enc.
+// Only absolute and pc relative pointers can be resolved; indirect pointers
+// are returned as the address holding the real value.
+func (r *ehReader) encoded(enc int) (value int, ok bool) {
+	if enc == ehPeOmit {
+		return 0, false
+	}
+	fieldAddr := r.addr + r.pos
+	switch enc & 0x0f {
+	case ehPeAbsptr:
+		value = r.fixed(r.ptrSize, false)
+	case ehPeUleb128:
+		value = r.uleb()
+	case ehPeUdata2:
+		value = r.fixed(2, false)
+	case ehPeUdata4:
+		value = r.fixed(4, false)
+	case ehPeUdata8:
+		value = r.fixed(8, false)
+	case ehPeSleb128:
+		value = r.sleb()
+	case ehPeSdata2:
+		value = r.fixed(2, true)
+	case ehPeSdata4:
+		value = r.fixed(4, true)
+	case ehPeSdata8:
+		value = r.fixed(8, true)
+	default:
+		return 0, false
+	}
+	switch enc & 0x70 {
+	case 0:
+	case ehPePcrel:
+		value += fieldAddr
+	default:
+		return value, false
+	}
+	return value, true
+}
+
+// ehCie is the information of a CIE needed to read its FDEs
+type ehCie struct {
+	augmentation string
+	fdeEnc       int
+	lsdaEnc      int
+}
+
+// ehFde is a function described in .eh_frame
+type ehFde struct {
+	Start int
+	End   int
+	Lsda  int // 0 if the function has no LSDA
+}
+
+// readEhFrame reads all FDEs in the .eh_frame section of the binary
+func readEhFrame(layout *binaryLayout) (fdes []ehFde) {
+	sec := layout.sectionByName(".eh_frame")
+	if sec == nil {
+		return
+	}
+	r := &ehReader{data: layout.data[sec], addr: int(sec.Addr),
+		order: layout.order, ptrSize: layout.ptrSize}
+	cies := make(map[int]*ehCie)
+	for !r.eof() {
+		entryStart := r.pos
+		length := r.fixed(4, false)
+		if length == 0 {
+			// Terminator
+			continue
+		}
+		if length == 0xffffffff {
+			length = r.fixed(8, false)
+		}
+		end := r.pos + length
+		if end > len(r.data) || length < 4 {
+			break
+		}
+		idPos := r.pos
+		id := r.fixed(4, false)
+		if id == 0 {
+			cie := &ehCie{fdeEnc: ehPeAbsptr, lsdaEnc: ehPeOmit}
+			version := r.u8()
+			cie.augmentation = r.cstring()
+			if strings.Contains(cie.augmentation, "eh") {
+				r.fixed(r.ptrSize, false)
+			}
+			r.uleb() // code alignment
+			r.sleb() // data alignment
+			if version == 1 {
+				r.u8()
+			} else {
+				r.uleb()
+			}
+			if strings.HasPrefix(cie.augmentation, "z") {
+				augEnd := r.uleb()
+				augEnd += r.pos
+			augmentation:
+				for _, c := range cie.augmentation[1:] {
+					switch c {
+					case 'L':
+						cie.lsdaEnc = r.u8()
+					case 'P':
+						r.encoded(r.u8())
+					case 'R':
+						cie.fdeEnc = r.u8()
+					case 'S', 'B':
+					default:
+						// Unknown data, skipped by the length below
+						break augmentation
+					}
+				}
+				r.pos = augEnd
+			}
+			cies[entryStart] = cie
+		} else if cie, ok := cies[idPos-id]; ok {
+			start, ok := r.encoded(cie.fdeEnc)
+			size, _ := r.encoded(cie.fdeEnc & 0x0f)
+			fde := ehFde{Start: start, End: start + size}
+			if strings.HasPrefix(cie.augmentation, "z") {
+				augEnd := r.uleb()
+				augEnd += r.pos
+				if strings.Contains(cie.augmentation, "L") {
+					lsdaEnc := cie.lsdaEnc
+					if lsda, lsdaOk := r.encoded(lsdaEnc &^ ehPeIndirect); lsdaOk && lsda != 0 {
+						if lsdaEnc&ehPeIndirect != 0 {
+							lsda, lsdaOk = layout.pointerAt(lsda, layout.ptrSize)
+						}
+						if lsdaOk {
+							fde.Lsda = lsda
+						}
+					}
+				}
+				r.pos = augEnd
+			}
+			if ok {
+				fdes = append(fdes, fde)
+			}
+		}
+		r.pos = end
+	}
+	return
+}
+
+// ehCallSite is a call site entry in an LSDA
+type ehCallSite struct {
+	Start      int
+	End        int
+	LandingPad int
+}
+
+// readLsda reads the call site table of the LSDA at address lsda for the
+// function starting at funcStart
+func readLsda(layout *binaryLayout, lsda, funcStart int) (sites []ehCallSite) {
+	sec := layout.sectionAt(lsda)
+	if sec == nil {
+		return
+	}
+	r := &ehReader{data: layout.data[sec], addr: int(sec.Addr),
+		pos: lsda - int(sec.Addr), order: layout.order, ptrSize: layout.ptrSize}
+	lpStart := funcStart
+	if lpEnc := r.u8(); lpEnc != ehPeOmit {
+		lpStart, _ = r.encoded(lpEnc)
+	}
+	if ttypeEnc := r.u8(); ttypeEnc != ehPeOmit {
+		r.uleb()
+	}
+	csEnc := r.u8()
+	tableEnd := r.uleb()
+	tableEnd += r.pos
+	for r.pos < tableEnd && !r.eof() {
+		start, _ := r.encoded(csEnc)
+		length, _ := r.encoded(csEnc)
+		lp, _ := r.encoded(csEnc)
+		r.uleb() // action
+		if lp == 0 {
+			// No landing pad, the exception continues unwinding
+			continue
+		}
+		sites = append(sites, ehCallSite{
+			Start:      funcStart + start,
+			End:        funcStart + start + length,
+			LandingPad: lpStart + lp,
+		})
+	}
+	return
+}
+
+// LandingPads finds the C++ exception landing pads using the LSDAs referenced
+// in .eh_frame. Landing pads are marked in insts, and call sites covered by a
+// landing pad get an edge to it.
+func LandingPads(binFile string, insts map[int]gtutils.InsnSupplementary) {
+	layout, err := readBinaryLayout(binFile)
+	if err != nil {
+		fmt.Printf("\tWARNING: %s cannot be open as elf, landing pads are not resolved\n", binFile)
+		return
+	}
+	insnLst := make([]int, 0, len(insts))
+	for offset := range insts {
+		insnLst = append(insnLst, offset)
+	}
+	sort.Ints(insnLst)
+	for _, fde := range readEhFrame(layout) {
+		if fde.Lsda == 0 {
+			continue
+		}
+		for _, site := range readLsda(layout, fde.Lsda, fde.Start) {
+			lp, ok := insts[site.LandingPad]
+			if !ok {
+				fmt.Printf("\tWARNING: landing pad %x is not in the ground truth\n", site.LandingPad)
+				continue
+			}
+			lp.LandingPad = true
+			insts[site.LandingPad] = lp
+			for i := sort.SearchInts(insnLst, site.Start); i < len(insnLst) && insnLst[i] < site.End; i++ {
+				supplementary := insts[insnLst[i]]
+				// Calls to non-returning functions (e.g. __cxa_throw) also get
+				// the edge, as they leave through the landing pad when unwinding
+				if supplementary.Class != gtutils.ClassCall && !supplementary.IndirectCall {
+					continue
+				}
+				edge := gtutils.InsnEdge{Dst: site.LandingPad, Kind: gtutils.EdgeLandingPad}
+				var found bool
+				for _, e := range supplementary.Edges {
+					if e == edge {
+						found = true
+						break
+					}
+				}
+				if !found {
+					// Overlapping call site entries give the same edge
+					supplementary.Edges = append(supplementary.Edges, edge)
+					insts[insnLst[i]] = supplementary
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package elfutils
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestEhReaderLeb(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		signed bool
+		want   int
+	}{
+		{"uleb 2", []byte{0x02}, false, 2},
+		{"uleb 127", []byte{0x7f}, false, 127},
+		{"uleb 128", []byte{0x80, 0x01}, false, 128},
+		{"uleb 624485", []byte{0xe5, 0x8e, 0x26}, false, 624485},
+		{"sleb 2", []byte{0x02}, true, 2},
+		{"sleb -2", []byte{0x7e}, true, -2},
+		{"sleb 127", []byte{0xff, 0x00}, true, 127},
+		{"sleb -128", []byte{0x80, 0x7f}, true, -128},
+		{"sleb -123456", []byte{0xc0, 0xbb, 0x78}, true, -123456},
+		{"truncated", []byte{0x80}, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &ehReader{data: tt.data, order: binary.LittleEndian, ptrSize: 8}
+			var got int
+			if tt.signed {
+				got = r.sleb()
+			} else {
+				got = r.uleb()
+			}
+			if got != tt.want || !r.eof() {
+				t.Errorf("got %d at %d, want %d at the end", got, r.pos, tt.want)
+			}
+		})
+	}
+}
+
+func TestEhReaderEncoded(t *testing.T) {
+	tests := []struct {
+		name    string
+		enc     int
+		data    []byte
+		ptrSize int
+		want    int
+		ok      bool
+	}{
+		{"absptr 8", ehPeAbsptr, []byte{0x00, 0x10, 0x40, 0, 0, 0, 0, 0}, 8, 0x401000, true},
+		{"absptr 4", ehPeAbsptr, []byte{0x00, 0x10, 0x40, 0}, 4, 0x401000, true},
+		{"udata2", ehPeUdata2, []byte{0xfe, 0xff}, 8, 0xfffe, true},
+		{"udata4", ehPeUdata4, []byte{0xfe, 0xff, 0xff, 0xff}, 8, 0xfffffffe, true},
+		{"sdata2", ehPeSdata2, []byte{0xfe, 0xff}, 8, -2, true},
+		{"sdata4", ehPeSdata4, []byte{0xfe, 0xff, 0xff, 0xff}, 8, -2, true},
+		{"uleb128", ehPeUleb128, []byte{0x80, 0x01}, 8, 128, true},
+		{"sleb128", ehPeSleb128, []byte{0x7e}, 8, -2, true},
+		{"pcrel sdata4", ehPePcrel | ehPeSdata4, []byte{0xf0, 0xff, 0xff, 0xff}, 8, 0x1000 - 0x10, true},
+		{"pcrel sdata8", ehPePcrel | ehPeSdata8, []byte{0x10, 0, 0, 0, 0, 0, 0, 0}, 8, 0x1000 + 0x10, true},
+		{"indirect pcrel", ehPeIndirect | ehPePcrel | ehPeSdata4, []byte{0x10, 0, 0, 0}, 8, 0x1000 + 0x10, true},
+		{"datarel", 0x30 | ehPeSdata4, []byte{0x10, 0, 0, 0}, 8, 0x10, false},
+		{"omit", ehPeOmit, nil, 8, 0, false},
+		{"unknown format", 0x05, []byte{0}, 8, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &ehReader{data: tt.data, addr: 0x1000, order: binary.LittleEndian, ptrSize: tt.ptrSize}
+			got, ok := r.encoded(tt.enc)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("encoded(%#x) = %#x, %v, want %#x, %v", tt.enc, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+// ehLayout builds a 64-bit binary layout of the sections at the addresses
+func ehLayout(sections map[string]int, data map[string][]byte) *binaryLayout {
+	layout := &binaryLayout{
+		order:   binary.LittleEndian,
+		ptrSize: 8,
+		data:    make(map[*elf.Section][]byte),
+	}
+	for name, addr := range sections {
+		sec := &elf.Section{SectionHeader: elf.SectionHeader{
+			Name: name,
+			Addr: uint64(addr),
+			Size: uint64(len(data[name])),
+		}}
+		layout.sections = append(layout.sections, sec)
+		layout.data[sec] = data[name]
+	}
+	return layout
+}
+
+func TestReadEhFrame(t *testing.T) {
+	const ehFrame = 0x2000
+	le32 := func(v int) []byte {
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint32(b, uint32(v))
+		return b
+	}
+	var data []byte
+	// CIE with an unknown augmentation Q skipped by the augmentation length
+	data = append(data, le32(17)...)
+	data = append(data, le32(0)...)
+	data = append(data, 1)
+	data = append(data, "zLRQ\x00"...)
+	data = append(data, 1, 0x78, 16)
+	data = append(data, 3, ehPePcrel|ehPeSdata4, ehPePcrel|ehPeSdata4, 0xaa)
+	// FDE for [0x1000, 0x1040) with an LSDA at 0x3000
+	data = append(data, le32(17)...)
+	data = append(data, le32(len(data))...)
+	data = append(data, le32(0x1000-(ehFrame+len(data)))...)
+	data = append(data, le32(0x40)...)
+	data = append(data, 4)
+	data = append(data, le32(0x3000-(ehFrame+len(data)))...)
+	// Terminator
+	data = append(data, le32(0)...)
+
+	layout := ehLayout(map[string]int{".eh_frame": ehFrame}, map[string][]byte{".eh_frame": data})
+	want := []ehFde{{Start: 0x1000, End: 0x1040, Lsda: 0x3000}}
+	if fdes := readEhFrame(layout); !reflect.DeepEqual(fdes, want) {
+		t.Errorf("readEhFrame() = %+v, want %+v", fdes, want)
+	}
+}
+
+func TestReadLsda(t *testing.T) {
+	lsda := []byte{
+		ehPeOmit,               // landing pad base is the function start
+		ehPeOmit,               // no type table
+		ehPeUleb128,            // call site encoding
+		8,                      // call site table length
+		0x04, 0x08, 0x20, 0x00, // [0x04, 0x0c) lands at 0x20
+		0x10, 0x04, 0x00, 0x00, // [0x10, 0x14) has no landing pad
+	}
+	layout := ehLayout(map[string]int{".gcc_except_table": 0x3000}, map[string][]byte{".gcc_except_table": lsda})
+	tests := []struct {
+		name string
+		lsda int
+		want []ehCallSite
+	}{
+		{"call sites", 0x3000, []ehCallSite{{Start: 0x1004, End: 0x100c, LandingPad: 0x1020}}},
+		{"outside sections", 0x4000, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if sites := readLsda(layout, tt.lsda, 0x1000); !reflect.DeepEqual(sites, tt.want) {
+				t.Errorf("readLsda() = %+v, want %+v", sites, tt.want)
+			}
+		})
+	}
+}
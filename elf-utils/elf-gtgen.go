@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 
 	objx86coff "github.com/pangine/pangineDSM-obj-x86-coff"
@@ -18,9 +19,10 @@ import (
 
 // ElfGroundtruthMatch is used to generate ground truth on target elf binary file
 func ElfGroundtruthMatch(
-	asmDir, objDir, mthFile, binName string,
+	asmDir, objDir, mthFile, binFile string,
 	symbolFuncs []gtutils.SymbolFuncInfo,
 	aoMap map[string]string,
+	libFuncs gtutils.LibraryIndex,
 	bi pstruct.BinaryInfo,
 	llvmTripleStruct genutils.LlvmTripleStruct,
 	gnuPrefix bool,
@@ -28,8 +30,10 @@ func ElfGroundtruthMatch(
 ) (
 	insts map[int]gtutils.InsnSupplementary,
 	funcs map[gtutils.FuncRow][]int,
+	extra gtutils.GtExtra,
 	failure bool,
 ) {
+	binName := filepath.Base(binFile)
 	bout, err := os.Create(mthFile)
 	if err != nil {
 		fmt.Printf("FATAL: mth file %s can not be written.\n", mthFile)
@@ -201,11 +205,31 @@ func ElfGroundtruthMatch(
 	insts = make(map[int]gtutils.InsnSupplementary)
 	funcs = make(map[gtutils.FuncRow][]int)
 	usedLst := make(map[string]bool)
+	entryAligns := make(map[int]string)
+	jtIndex := NewJumpTableIndex(binFile)
+	// Symbols sharing one body only need one of them matched
+	folded := gtutils.FoldedOffsets(symbolFuncs)
+	bodyAt := make(map[int]string)
+	pendingAliases := make([]gtutils.SymbolFuncInfo, 0)
+	noListing := make([]gtutils.SymbolFuncInfo, 0)
 	for sID, symbol := range symbolFuncs {
 		fName := symbol.Function
+		if folded[symbol.Offset] {
+			if body, ok := bodyAt[symbol.Offset]; ok {
+				fmt.Printf("\tINFO: %s > %s is folded into %s\n", symbol.Source, fName, body)
+				extra.FuncAliases = append(extra.FuncAliases,
+					gtutils.FuncAliasRow{FuncStart: symbol.Offset, Name: fName})
+				continue
+			}
+		}
 		if len(funcCandidates[fName]) == 0 {
+			if folded[symbol.Offset] {
+				pendingAliases = append(pendingAliases, symbol)
+				continue
+			}
 			fmt.Printf("\tWARNING: no candidates for %s > %s\n",
 				symbol.Source, fName)
+			noListing = append(noListing, symbol)
 			continue
 		}
 		var failToMatch bool
@@ -271,12 +295,22 @@ func ElfGroundtruthMatch(
 					fmt.Println("\t" + mthLines[sID])
 					// Locale Aggressive new Root Search
 					// TODO: turn off
+					dataRegions := gtutils.ResolveDataRegions(funcByLst[lst][fName], symbol.Offset, bi)
 					gtutils.AggressiveRootSearch(partNewRoots,
 						partInsts,
 						symbol.Offset,
 						upbound,
+						dataRegions,
 						bi,
 						objx86elf.ObjectElf{})
+					extra.DataRegions = append(extra.DataRegions, dataRegions...)
+					extra.Padding = append(extra.Padding,
+						gtutils.ResolvePadding(funcByLst[lst][fName], symbol.Offset, bi)...)
+					entryAligns[symbol.Offset] = funcByLst[lst][fName].EntryAlign
+					gtutils.ResolveCfa(funcByLst[lst][fName], symbol.Offset, bi,
+						llvmTripleStruct.Arch == "x86_64", partInsts)
+					extra.JumpTables = append(extra.JumpTables,
+						jtIndex.ResolveJumpTables(funcByLst[lst][fName], symbol.Offset, bi, partInsts)...)
 					insnLst := make([]int, 0)
 					for insn, supplementary := range partInsts {
 						insnLst = append(insnLst, insn)
@@ -284,7 +318,7 @@ func ElfGroundtruthMatch(
 							insts[insn] = supplementary
 						} else {
 							// Already have this instruction
-							insts[insn] = gtutils.InsnSupplementary{Optional: supplementary.Optional && insts[insn].Optional}
+							insts[insn] = gtutils.MergeInsnSupplementary(insts[insn], supplementary)
 						}
 					}
 					funcs[gtutils.FuncRow{
@@ -292,6 +326,7 @@ func ElfGroundtruthMatch(
 						Start: symbol.Offset,
 						End:   upbound,
 					}] = insnLst
+					bodyAt[symbol.Offset] = symbol.Function
 					usedLst[lst] = true
 					break
 				}
@@ -305,13 +340,68 @@ func ElfGroundtruthMatch(
 				failToMatch = true
 			}
 		}
-		if failToMatch {
+		if failToMatch && folded[symbol.Offset] {
+			// Another symbol of the same body may still match
+			pendingAliases = append(pendingAliases, symbol)
+		} else if failToMatch {
 			// Do not generate real error for now, just log it
 			fmt.Println("\tERROR: (WITHHOLD) " + symbol.Source + " > " + fName + " cannot find a match\n")
+			noListing = append(noListing, symbol)
 			//failure = true
 			//return
 		}
 	}
+	for _, symbol := range pendingAliases {
+		if body, ok := bodyAt[symbol.Offset]; ok {
+			fmt.Printf("\tINFO: %s > %s is folded into %s\n", symbol.Source, symbol.Function, body)
+			extra.FuncAliases = append(extra.FuncAliases,
+				gtutils.FuncAliasRow{FuncStart: symbol.Offset, Name: symbol.Function})
+			continue
+		}
+		fmt.Println("\tERROR: (WITHHOLD) " + symbol.Source + " > " + symbol.Function + " cannot find a match\n")
+		noListing = append(noListing, symbol)
+	}
+	// Library code that no listing describes
+	gtutils.DecodeCodeRanges(gtutils.MatchLibraryFuncs(libFuncs, noListing, bi),
+		gtutils.OriginLibrary, insts, funcs, bi, objx86elf.ObjectElf{})
+	// Linker generated code that no listing describes
+	gtutils.DecodeCodeRanges(ElfLinkerStubs(binFile, noListing), gtutils.OriginLinker, insts, funcs, bi, objx86elf.ObjectElf{})
+
+	// Function pointers in data sections, from the relocations of all objects
+	objFiles := make([]string, 0, len(aoMap))
+	for _, obj := range aoMap {
+		objFiles = append(objFiles, obj)
+	}
+	sort.Strings(objFiles)
+	extra.AddressTaken = AddressTaken(objDir, objFiles, binFile)
+	extra.Symbolization = Symbolization(objDir, objFiles, binFile, insts)
+	LandingPads(binFile, insts)
+
+	// Call targets outside the ground truth functions, e.g. PLT entries
+	callNames := make(map[int]string)
+	for _, r := range extra.Symbolization {
+		switch insts[r.Insn].Class {
+		case gtutils.ClassCall, gtutils.ClassJmp:
+			if r.Target >= 0 {
+				callNames[r.Target] = r.Symbol
+			}
+		}
+	}
+	extra.FuncAttrs = gtutils.AnnotateCalls(insts, funcs, callNames, nil)
+
+	// Entry instrumentation and the padding reserved before function starts
+	entryPadding := gtutils.ResolveEntries(extra.FuncAttrs, insts, funcs, callNames, ElfPatchSites(binFile), false, bi)
+	extra.Padding = gtutils.FillPadding(append(extra.Padding, entryPadding...), funcs, symbolFuncs, entryAligns, bi, objx86elf.ObjectElf{})
+
+	// Compilers of the binary and every function
+	metadata, producers := ElfProducers(binFile, funcs)
+	extra.Metadata = metadata
+	gtutils.SetFuncProducers(extra.FuncAttrs, producers)
+
+	// Subroutines inlined into the functions
+	extra.Inlines = ElfInlines(binFile, funcs)
+	gtutils.SetInlineChains(insts, extra.Inlines)
+	extra.Prototypes = ElfPrototypes(binFile, funcs, llvmTripleStruct.Arch == "x86_64")
 	// TODO: global new root findings
 	for _, matchLine := range mthLines {
 		if matchLine == "" {
@@ -0,0 +1,133 @@
+package elfutils
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"fmt"
+	"sort"
+
+	gtutils "github.com/pangine/disasm-gt-generator/gtutils"
+)
+
+// dwarfName resolves the name of a debugging information entry, following
+// DW_AT_abstract_origin and DW_AT_specification
+func dwarfName(d *dwarf.Data, e *dwarf.Entry, cache map[dwarf.Offset]string) string {
+	for depth := 0; e != nil && depth < 8; depth++ {
+		if name, ok := cache[e.Offset]; ok {
+			return name
+		}
+		if name, ok := e.Val(dwarf.AttrName).(string); ok {
+			cache[e.Offset] = name
+			return name
+		}
+		ref, ok := e.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+		if !ok {
+			if ref, ok = e.Val(dwarf.AttrSpecification).(dwarf.Offset); !ok {
+				return ""
+			}
+		}
+		r := d.Reader()
+		r.Seek(ref)
+		e, _ = r.Next()
+	}
+	return ""
+}
+
+// ElfInlines reads DW_TAG_inlined_subroutine entries of an elf binary.
+// Every range is assigned to the function in funcs containing it.
+func ElfInlines(binFile string, funcs map[gtutils.FuncRow][]int) (inlines []gtutils.InlineRow) {
+	f, err := elf.Open(binFile)
+	if err != nil {
+		fmt.Printf("\tWARNING: %s cannot be open as elf, inlined subroutines are not resolved\n", binFile)
+		return
+	}
+	defer f.Close()
+	d, err := f.DWARF()
+	if err != nil {
+		// No debug information
+		return
+	}
+	funcLst := make([]gtutils.FuncRow, 0, len(funcs))
+	for fr := range funcs {
+		funcLst = append(funcLst, fr)
+	}
+	sort.Slice(funcLst, func(i, j int) bool {
+		return funcLst[i].Start < funcLst[j].Start
+	})
+	funcOf := func(addr int) int {
+		i := sort.Search(len(funcLst), func(i int) bool {
+			return funcLst[i].Start > addr
+		}) - 1
+		if i < 0 || addr >= funcLst[i].End {
+			return -1
+		}
+		return funcLst[i].Start
+	}
+
+	names := make(map[dwarf.Offset]string)
+	var files []*dwarf.LineFile
+	// Tags of the entries enclosing the current one
+	var stack []dwarf.Tag
+	var inlineDepth int
+	r := d.Reader()
+	for {
+		e, err := r.Next()
+		if err != nil || e == nil {
+			break
+		}
+		if e.Tag == 0 {
+			// End of children
+			if len(stack) > 0 {
+				if stack[len(stack)-1] == dwarf.TagInlinedSubroutine {
+					inlineDepth--
+				}
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+		if e.Tag == dwarf.TagCompileUnit {
+			stack = stack[:0]
+			inlineDepth = 0
+			files = nil
+			if lr, err := d.LineReader(e); err == nil && lr != nil {
+				files = lr.Files()
+			}
+		}
+		if e.Tag == dwarf.TagInlinedSubroutine {
+			callee := dwarfName(d, e, names)
+			var callFile string
+			if idx, ok := e.Val(dwarf.AttrCallFile).(int64); ok &&
+				idx >= 0 && int(idx) < len(files) && files[idx] != nil {
+				callFile = files[idx].Name
+			}
+			callLine, _ := e.Val(dwarf.AttrCallLine).(int64)
+			callColumn, _ := e.Val(dwarf.AttrCallColumn).(int64)
+			ranges, _ := d.Ranges(e)
+			for _, rg := range ranges {
+				inlines = append(inlines, gtutils.InlineRow{
+					FuncStart:  funcOf(int(rg[0])),
+					Start:      int(rg[0]),
+					End:        int(rg[1]),
+					Callee:     callee,
+					CallFile:   callFile,
+					CallLine:   int(callLine),
+					CallColumn: int(callColumn),
+					Depth:      inlineDepth + 1,
+				})
+			}
+		}
+		if e.Children {
+			stack = append(stack, e.Tag)
+			if e.Tag == dwarf.TagInlinedSubroutine {
+				inlineDepth++
+			}
+		}
+	}
+	sort.SliceStable(inlines, func(i, j int) bool {
+		if inlines[i].Start != inlines[j].Start {
+			return inlines[i].Start < inlines[j].Start
+		}
+		return inlines[i].Depth < inlines[j].Depth
+	})
+	return
+}
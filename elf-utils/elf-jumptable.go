@@ -0,0 +1,228 @@
+package elfutils
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	gtutils "github.com/pangine/disasm-gt-generator/gtutils"
+	pstruct "github.com/pangine/pangineDSM-utils/program-struct"
+)
+
+// dataSection is a non-executable allocated section of a binary
+type dataSection struct {
+	addr int
+	data []byte
+}
+
+// JumpTableIndex holds the data sections of a binary to locate jump tables
+type JumpTableIndex struct {
+	sections []dataSection
+	got      int // Address of _GLOBAL_OFFSET_TABLE_, 0 if unknown
+}
+
+// Kinds of jump table entries
+const (
+	entryAbsolute     = "abs"  // entry is the target address
+	entrySelfRelative = "self" // entry is relative to the address of the table
+	entryRelative     = "rel"  // entry is relative to another known address
+)
+
+// NewJumpTableIndex reads the data sections of the input elf binary
+func NewJumpTableIndex(binFile string) (idx *JumpTableIndex) {
+	idx = &JumpTableIndex{}
+	f, err := elf.Open(binFile)
+	if err != nil {
+		fmt.Printf("\tWARNING: %s cannot be open as elf, jump tables are not resolved\n", binFile)
+		return
+	}
+	defer f.Close()
+	for _, sec := range f.Sections {
+		if sec.Type != elf.SHT_PROGBITS ||
+			sec.Flags&elf.SHF_ALLOC == 0 ||
+			sec.Flags&elf.SHF_EXECINSTR != 0 {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			continue
+		}
+		idx.sections = append(idx.sections, dataSection{addr: int(sec.Addr), data: data})
+	}
+	// i386 PIC tables are addressed relative to the GOT (@GOTOFF)
+	if symbols, err := f.Symbols(); err == nil {
+		for _, symbol := range symbols {
+			if symbol.Name == gtutils.GotSymbol {
+				idx.got = int(symbol.Value)
+				break
+			}
+		}
+	}
+	if idx.got == 0 {
+		if sec := f.Section(".got.plt"); sec != nil {
+			idx.got = int(sec.Addr)
+		}
+	}
+	return
+}
+
+// readEntry reads an entry of entrySize bytes at offset of data.
+// 4 bytes entries are signed if they are relative.
+func readEntry(data []byte, offset, entrySize int, signed bool) int {
+	if entrySize == 8 {
+		return int(int64(binary.LittleEndian.Uint64(data[offset:])))
+	}
+	if signed {
+		return int(int32(binary.LittleEndian.Uint32(data[offset:])))
+	}
+	return int(binary.LittleEndian.Uint32(data[offset:]))
+}
+
+// tableAddresses returns the possible table addresses encoded in a 4 bytes
+// field of the insn referencing the table: an absolute address, a RIP
+// relative displacement, or a displacement from the GOT.
+func (idx *JumpTableIndex) tableAddresses(ref, length int, bi pstruct.BinaryInfo) (addrs []int) {
+	phy := pstruct.V2PConv(bi.ProgramHeaders, ref)
+	if phy < 0 || phy+length > len(bi.Sections.Data) {
+		return
+	}
+	code := bi.Sections.Data[phy : phy+length]
+	seen := make(map[int]bool)
+	add := func(addr int) {
+		if !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	// The displacement or immediate follows at least one opcode byte
+	for off := length - 4; off >= 1; off-- {
+		disp := int(int32(binary.LittleEndian.Uint32(code[off:])))
+		add(int(binary.LittleEndian.Uint32(code[off:])))
+		add(ref + length + disp)
+		if idx.got != 0 {
+			add(idx.got + disp)
+		}
+	}
+	return
+}
+
+// entriesAt reads n entries at virtual address addr
+func (idx *JumpTableIndex) entriesAt(addr, entrySize, n int, signed bool) (entries []int) {
+	for _, sec := range idx.sections {
+		if addr < sec.addr || addr+entrySize*n > sec.addr+len(sec.data) {
+			continue
+		}
+		for i := 0; i < n; i++ {
+			entries = append(entries, readEntry(sec.data, addr-sec.addr+i*entrySize, entrySize, signed))
+		}
+		return
+	}
+	return
+}
+
+// ResolveJumpTables locates the jump tables of a matched LST function in the binary
+func (idx *JumpTableIndex) ResolveJumpTables(
+	f *gtutils.LstFunc,
+	funcStart int,
+	bi pstruct.BinaryInfo,
+	insnOffsets map[int]gtutils.InsnSupplementary,
+) (tables []gtutils.JumpTableRow) {
+	headers := bi.ProgramHeaders
+	phyFuncStart := pstruct.V2PConv(headers, funcStart)
+	labelAddr := gtutils.LabelAddresses(f, funcStart, bi)
+	refAddr := make(map[string]int)
+	for _, insn := range f.InsnAry {
+		for _, ref := range insn.Refs {
+			if _, ok := refAddr[ref]; !ok {
+				refAddr[ref] = pstruct.P2VConv(headers, phyFuncStart+insn.Offset)
+			}
+		}
+	}
+	indirects := make([]int, 0)
+	for offset, supplementary := range insnOffsets {
+		if supplementary.Class == gtutils.ClassIndirect && !supplementary.IndirectCall {
+			indirects = append(indirects, offset)
+		}
+	}
+	sort.Ints(indirects)
+
+	for _, t := range f.JumpTables {
+		targets := make([]int, 0, len(t.Entries))
+		for _, e := range t.Entries {
+			addr, ok := labelAddr[e]
+			if !ok {
+				break
+			}
+			targets = append(targets, addr)
+		}
+		if len(targets) != len(t.Entries) || len(targets) == 0 {
+			fmt.Printf("\t\tWARNING: jump table %s has targets out of function\n", t.Label)
+			continue
+		}
+		kind := entryAbsolute
+		var base int
+		if t.Base == t.Label {
+			kind = entrySelfRelative
+		} else if t.Base == gtutils.GotSymbol {
+			if idx.got == 0 {
+				fmt.Printf("\t\tWARNING: jump table %s is relative to an unknown GOT\n", t.Label)
+				continue
+			}
+			base = idx.got
+			kind = entryRelative
+		} else if t.Base != "" {
+			var ok bool
+			if base, ok = labelAddr[t.Base]; !ok {
+				fmt.Printf("\t\tWARNING: jump table %s has an unknown base %s\n", t.Label, t.Base)
+				continue
+			}
+			kind = entryRelative
+		}
+		row := gtutils.JumpTableRow{
+			FuncStart: funcStart,
+			EntrySize: t.EntrySize,
+			Targets:   targets,
+			Owner:     -1,
+		}
+		ref, ok := refAddr[t.Label]
+		if !ok {
+			fmt.Printf("\t\tWARNING: jump table %s is not referenced by any insn\n", t.Label)
+			continue
+		}
+		var found bool
+		for _, addr := range idx.tableAddresses(ref, insnOffsets[ref].Length, bi) {
+			entries := idx.entriesAt(addr, t.EntrySize, len(targets), kind != entryAbsolute)
+			if len(entries) != len(targets) {
+				continue
+			}
+			if kind == entrySelfRelative {
+				base = addr
+			}
+			found = true
+			for i, e := range entries {
+				if e+base != targets[i] {
+					found = false
+					break
+				}
+			}
+			if found {
+				row.Address = addr
+				row.Base = base
+				row.Entries = entries
+				break
+			}
+		}
+		if !found {
+			fmt.Printf("\t\tWARNING: jump table %s cannot be located in binary\n", t.Label)
+			continue
+		}
+		// The owner is the first indirect jump after the insn referencing the table
+		i := sort.SearchInts(indirects, ref)
+		if i < len(indirects) {
+			row.Owner = indirects[i]
+		}
+		tables = append(tables, row)
+	}
+	return
+}
@@ -0,0 +1,92 @@
+package elfutils
+
+import (
+	"debug/elf"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	gtutils "github.com/pangine/disasm-gt-generator/gtutils"
+)
+
+// ReadLibraryObjects reads the functions of all elf objects (.o) under libDir
+func ReadLibraryObjects(libDir string) (lib gtutils.LibraryIndex) {
+	lib = make(gtutils.LibraryIndex)
+	if libDir == "" {
+		return
+	}
+	filepath.Walk(libDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".o") {
+			return nil
+		}
+		f, err := elf.Open(path)
+		if err != nil {
+			fmt.Printf("\tWARNING: library object %s cannot be open as elf\n", path)
+			return nil
+		}
+		defer f.Close()
+		syms, _ := f.Symbols()
+		masks := make(map[int][]bool)
+		datas := make(map[int][]byte)
+		// Pointers back into their own sections, e.g. jump table entries
+		pointers := make(map[int][]int)
+		ptrSize := 4
+		if f.Class == elf.ELFCLASS64 {
+			ptrSize = 8
+		}
+		for _, r := range readObjRelocs(f, syms) {
+			if _, ok := masks[r.Section]; !ok {
+				data, _ := f.Sections[r.Section].Data()
+				datas[r.Section] = data
+				masks[r.Section] = make([]bool, len(data))
+			}
+			// Bytes the linker may rewrite when relaxing are not compared either
+			before, after := relaxWindow(f.Machine, r.Type)
+			for i := r.Offset - before; i < r.Offset+r.Size+after && i < len(masks[r.Section]); i++ {
+				if i >= 0 {
+					masks[r.Section][i] = true
+				}
+			}
+			if isPointerReloc(f.Machine, r.Type) && r.Size == ptrSize && int(r.Symbol.Section) == r.Section {
+				pointers[r.Section] = append(pointers[r.Section], r.Offset)
+			}
+		}
+		for _, offsets := range pointers {
+			sort.Ints(offsets)
+		}
+		for _, s := range syms {
+			if elf.ST_TYPE(s.Info) != elf.STT_FUNC || s.Size == 0 ||
+				int(s.Section) <= 0 || int(s.Section) >= len(f.Sections) {
+				continue
+			}
+			secIdx := int(s.Section)
+			if _, ok := datas[secIdx]; !ok {
+				data, _ := f.Sections[secIdx].Data()
+				datas[secIdx] = data
+				masks[secIdx] = make([]bool, len(data))
+			}
+			start, end := int(s.Value), int(s.Value+s.Size)
+			if end > len(datas[secIdx]) {
+				continue
+			}
+			codeSize := end - start
+			offsets := pointers[secIdx]
+			lo := sort.SearchInts(offsets, start)
+			hi := sort.SearchInts(offsets, end)
+			if table := gtutils.TableStart(offsets[lo:hi], ptrSize); table >= 0 {
+				codeSize = table - start
+			}
+			lib.Add(gtutils.LibraryFunc{
+				Name:      s.Name,
+				Object:    filepath.Base(path),
+				Code:      datas[secIdx][start:end],
+				Relocated: masks[secIdx][start:end],
+				CodeSize:  codeSize,
+			})
+		}
+		return nil
+	})
+	return
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -235,9 +236,13 @@ func ReadLst(
 
 	// Second iteration, record instructions and labels in functions
 	var inTextSection, inFunction, startFunction, sameLineAsLast, lastIsAlign bool
-	var fName, lName string
-	var funcOffset, lastLine, lastInsnLine, labelIndex int
+	var fName, lName, tableLabel, entryAlign string
+	var funcOffset, lastLine, lastInsnLine, lastDataLine, labelIndex int
+	var locFile string
+	var locLine, locColumn int
+	var pendingCfi []string
 	sourceList := make(map[int]string)
+	jumpTables := make(map[string]*gtutils.LstJumpTable)
 	lines = bufio.NewScanner(bin)
 	for lines.Scan() {
 		line := lines.Text()
@@ -308,7 +313,10 @@ func ReadLst(
 			funcList[fields[1][:len(fields[1])-1]] {
 			// Pattern "func_name:"
 			fName = fields[1][:len(fields[1])-1]
-			funcMap[fName] = &gtutils.LstFunc{}
+			funcMap[fName] = &gtutils.LstFunc{EntryAlign: entryAlign}
+			entryAlign = ""
+			locFile, locLine, locColumn = "", 0, 0
+			pendingCfi = nil
 			startFunction = true
 			inFunction = true
 			lName = fields[1]
@@ -320,6 +328,31 @@ func ReadLst(
 			inFunction = false
 			continue
 		}
+		if !inFunction && inTextSection {
+			// Align directive before a function
+			// line# offset hex .p2align ...
+			for i := 1; i < len(fields) && i <= 3; i++ {
+				if strIsAlign(fields[i]) {
+					entryAlign = directiveText(fields[i:])
+					break
+				}
+			}
+		}
+		if !inTextSection {
+			entryAlign = ""
+			// Jump tables are in data sections, and may be out of functions (clang)
+			// line# .L4:
+			// line# offset hex .long .L5-.L4
+			// line# offset hex .quad .L7
+			if fields[1] == ".section" {
+				tableLabel = ""
+			} else if strings.HasSuffix(fields[1], ":") {
+				tableLabel = strings.TrimSuffix(fields[1], ":")
+			} else if offsetErr == nil && len(fields) >= 5 && tableLabel != "" &&
+				!addJumpTableEntries(jumpTables, tableLabel, fields[3], strings.Join(fields[4:], "")) {
+				tableLabel = ""
+			}
+		}
 		if !inFunction {
 			continue
 		}
@@ -333,12 +366,30 @@ func ReadLst(
 			continue
 		}
 		if len(fields) > 3 && fields[1] == ".loc" {
+			// .loc file line [column] [options]
 			// Specify source code file for this function
 			ref, err := strconv.ParseInt(fields[2], 10, 64)
 			_, ok := sourceList[int(ref)]
 			if funcMap[fName].Source == "" && ok && err == nil {
 				funcMap[fName].Source = sourceList[int(ref)]
 			}
+			// Active source location for the following insns
+			locFile = sourceList[int(ref)]
+			locLine, locColumn = 0, 0
+			if line64, err := strconv.ParseInt(fields[3], 10, 64); err == nil {
+				locLine = int(line64)
+			}
+			if len(fields) > 4 {
+				if column64, err := strconv.ParseInt(fields[4], 10, 64); err == nil {
+					locColumn = int(column64)
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(fields[1], ".cfi_") {
+			// .cfi_def_cfa_offset 16
+			// Call frame information applies to the following insns
+			pendingCfi = append(pendingCfi, strings.Join(fields[1:], " "))
 			continue
 		}
 		if inTextSection &&
@@ -368,10 +419,14 @@ func ReadLst(
 					)
 				}
 				var isAlign bool
+				var align string
 				if strIsAlign(fields[3]) {
+					align = directiveText(fields[3:])
 					if lastIsAlign {
 						// Two neighboring align, considered as one
-						funcMap[fName].InsnAry[len(funcMap[fName].InsnAry)-1].Length += len(fields[2]) / 2
+						lastInsn := &funcMap[fName].InsnAry[len(funcMap[fName].InsnAry)-1]
+						lastInsn.Length += len(fields[2]) / 2
+						lastInsn.Align += "; " + align
 						continue
 					}
 					isAlign = true
@@ -387,8 +442,16 @@ func ReadLst(
 						IsAlign: isAlign,
 						Label:   lName,
 						Index:   labelIndex,
+						Refs:    localLabelRefs(fields[3:]),
+						Align:   align,
+						File:    locFile,
+						Line:    locLine,
+						Column:  locColumn,
+						LstLine: lineNumber,
+						Cfi:     pendingCfi,
 					},
 				)
+				pendingCfi = nil
 				labelIndex++
 				lastInsnLine = lineNumber
 			}
@@ -400,6 +463,30 @@ func ReadLst(
 			funcMap[fName].FuncLen += len(fields[1]) / 2
 			continue
 		}
+		if sameLineAsLast && lastDataLine == lineNumber {
+			// length of last data piece needs extends
+			funcMap[fName].DataAry[len(funcMap[fName].DataAry)-1].Length += len(fields[1]) / 2
+			funcMap[fName].FuncLen += len(fields[1]) / 2
+			continue
+		}
+		if inTextSection &&
+			offsetErr == nil &&
+			len(fields) >= 4 &&
+			fields[3][0] == '.' &&
+			isHexBytes(fields[2]) {
+			// line# offset hex .byte ...
+			// line# offset hex .long ...
+			if startFunction {
+				startFunction = false
+				funcOffset = offset
+			}
+			relativeOffset := offset - funcOffset
+			funcMap[fName].FuncLen = relativeOffset + len(fields[2])/2
+			funcMap[fName].AddData(relativeOffset, len(fields[2])/2, fields[3], localLabelRefs(fields[4:]))
+			lastDataLine = lineNumber
+			lastIsAlign = false
+			continue
+		}
 		if inTextSection &&
 			offsetErr == nil &&
 			len(fields) >= 4 &&
@@ -426,12 +513,114 @@ func ReadLst(
 				removeLabel++
 			}
 		}
+		funcMap[f].TailAligns = v.InsnAry[len(v.InsnAry)-removeInsn:]
 		funcMap[f].InsnAry = funcMap[f].InsnAry[:len(v.InsnAry)-removeInsn]
 		funcMap[f].LabelAry = funcMap[f].LabelAry[:len(funcMap[f].LabelAry)-removeLabel]
 	}
+	// attach jump tables to the functions referencing them
+	for _, v := range funcMap {
+		attached := make(map[string]bool)
+		for _, insn := range v.InsnAry {
+			for _, ref := range insn.Refs {
+				if table, ok := jumpTables[ref]; ok && !attached[ref] {
+					attached[ref] = true
+					v.JumpTables = append(v.JumpTables, *table)
+				}
+			}
+		}
+	}
+	return
+}
+
+// jumpTableEntrySizes are the data directives used by compilers for jump table entries
+var jumpTableEntrySizes = map[string]int{
+	".long":  4,
+	".4byte": 4,
+	".int":   4,
+	".quad":  8,
+	".8byte": 8,
+}
+
+// addJumpTableEntries records the data directive under label as jump table entries.
+// Returns false if the directive is not a jump table entry.
+func addJumpTableEntries(
+	jumpTables map[string]*gtutils.LstJumpTable,
+	label, directive, operands string,
+) bool {
+	entrySize, ok := jumpTableEntrySizes[directive]
+	if !ok {
+		return false
+	}
+	if comment := strings.Index(operands, "#"); comment >= 0 {
+		operands = operands[:comment]
+	}
+	for _, op := range strings.Split(operands, ",") {
+		// .L5-.L4, .L7 or .L3@GOTOFF
+		var target, base string
+		if minus := strings.Index(op, "-"); minus >= 0 {
+			target, base = op[:minus], op[minus+1:]
+		} else if strings.HasSuffix(op, "@GOTOFF") {
+			target, base = strings.TrimSuffix(op, "@GOTOFF"), gtutils.GotSymbol
+		} else {
+			target = op
+		}
+		if !strings.HasPrefix(target, ".L") {
+			return false
+		}
+		table, ok := jumpTables[label]
+		if !ok {
+			table = &gtutils.LstJumpTable{
+				Label:     label,
+				EntrySize: entrySize,
+				Base:      base,
+			}
+			jumpTables[label] = table
+		} else if table.EntrySize != entrySize || table.Base != base {
+			return false
+		}
+		table.Entries = append(table.Entries, target)
+	}
+	return true
+}
+
+// localLabelRefs returns the local labels referenced in the fields of an insn
+func localLabelRefs(fields []string) (refs []string) {
+	for _, field := range fields {
+		if strings.HasPrefix(field, "#") {
+			// Comment til the end
+			break
+		}
+		refs = append(refs, localLabelPattern.FindAllString(field, -1)...)
+	}
 	return
 }
 
+var localLabelPattern = regexp.MustCompile(`\.L[A-Za-z0-9_.$]+`)
+
+// directiveText returns the directive in fields without comments
+func directiveText(fields []string) string {
+	for i, field := range fields {
+		if strings.HasPrefix(field, "#") {
+			fields = fields[:i]
+			break
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// isHexBytes checks if str is the hex bytes field of a LST line
+func isHexBytes(str string) bool {
+	if len(str) == 0 || len(str)%2 != 0 {
+		return false
+	}
+	for _, c := range str {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
 func strIsAlign(str string) bool {
 	return strings.HasPrefix(str, ".") && strings.HasSuffix(str, "align")
 }
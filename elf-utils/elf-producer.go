@@ -0,0 +1,78 @@
+package elfutils
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"fmt"
+	"strings"
+
+	gtutils "github.com/pangine/disasm-gt-generator/gtutils"
+)
+
+// ElfProducers reads the compilers of an elf binary from DW_AT_producer of
+// its compile units and the .comment section. Functions are assigned the
+// producers of the compile units covering their starts.
+func ElfProducers(binFile string, funcs map[gtutils.FuncRow][]int) (metadata []gtutils.MetadataRow, producers map[int]string) {
+	producers = make(map[int]string)
+	f, err := elf.Open(binFile)
+	if err != nil {
+		fmt.Printf("\tWARNING: %s cannot be open as elf, producers are not resolved\n", binFile)
+		return
+	}
+	defer f.Close()
+
+	if sec := f.Section(".comment"); sec != nil {
+		if data, err := sec.Data(); err == nil {
+			comments := make([]string, 0)
+			for _, c := range strings.Split(string(data), "\x00") {
+				if c != "" {
+					comments = append(comments, c)
+				}
+			}
+			metadata = append(metadata, gtutils.CountProducers("comment", comments)...)
+		}
+	}
+
+	d, err := f.DWARF()
+	if err != nil {
+		// No debug information
+		return
+	}
+	type cuRange struct {
+		producer   string
+		start, end int
+	}
+	cuProducers := make([]string, 0)
+	cuRanges := make([]cuRange, 0)
+	r := d.Reader()
+	for {
+		e, err := r.Next()
+		if err != nil || e == nil {
+			break
+		}
+		if e.Tag != dwarf.TagCompileUnit {
+			r.SkipChildren()
+			continue
+		}
+		producer, _ := e.Val(dwarf.AttrProducer).(string)
+		r.SkipChildren()
+		if producer == "" {
+			continue
+		}
+		cuProducers = append(cuProducers, producer)
+		ranges, _ := d.Ranges(e)
+		for _, rg := range ranges {
+			cuRanges = append(cuRanges, cuRange{producer, int(rg[0]), int(rg[1])})
+		}
+	}
+	metadata = append(metadata, gtutils.CountProducers("dwarf", cuProducers)...)
+	for fr := range funcs {
+		for _, rg := range cuRanges {
+			if fr.Start >= rg.start && fr.Start < rg.end {
+				producers[fr.Start] = rg.producer
+				break
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,203 @@
+package elfutils
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"fmt"
+	"sort"
+
+	gtutils "github.com/pangine/disasm-gt-generator/gtutils"
+)
+
+// dwarfCallingConventions names DW_AT_calling_convention values, see
+// llvm/BinaryFormat/Dwarf.def
+var dwarfCallingConventions = map[int64]string{
+	0x2:  "program",
+	0x3:  "nocall",
+	0x41: "borland-fastcall", // DW_CC_GNU_borland_fastcall_i386
+	0xb0: "safecall",
+	0xb1: "stdcall",
+	0xb2: "pascal",
+	0xb3: "fastcall", // DW_CC_BORLAND_msfastcall
+	0xb5: "thiscall",
+	0xb6: "borland-fastcall",
+	0xc0: "vectorcall",
+	0xc1: "win64",
+	0xc2: "sysv64",
+	0xc3: "aapcs",
+	0xc4: "aapcs-vfp",
+	0xc5: "intel-ocl-bicc",
+	0xc6: "spir-function",
+}
+
+// dwarfEntryAt reads the entry at offset
+func dwarfEntryAt(d *dwarf.Data, offset dwarf.Offset) *dwarf.Entry {
+	r := d.Reader()
+	r.Seek(offset)
+	e, _ := r.Next()
+	return e
+}
+
+// dwarfChildren reads the direct children of an entry
+func dwarfChildren(d *dwarf.Data, e *dwarf.Entry) (children []*dwarf.Entry) {
+	if !e.Children {
+		return
+	}
+	r := d.Reader()
+	r.Seek(e.Offset)
+	r.Next()
+	for {
+		child, err := r.Next()
+		if err != nil || child == nil || child.Tag == 0 {
+			return
+		}
+		children = append(children, child)
+		if child.Children {
+			r.SkipChildren()
+		}
+	}
+}
+
+// dwarfTypeRef normalizes the type referenced by an entry's DW_AT_type
+func dwarfTypeRef(d *dwarf.Data, e *dwarf.Entry) (t gtutils.TypeRef) {
+	t.Base = "void"
+	for depth := 0; e != nil && depth < 32; depth++ {
+		ref, ok := e.Val(dwarf.AttrType).(dwarf.Offset)
+		if !ok {
+			// No type is void
+			return
+		}
+		e = dwarfEntryAt(d, ref)
+		if e == nil {
+			return
+		}
+		switch e.Tag {
+		case dwarf.TagPointerType, dwarf.TagReferenceType, dwarf.TagRvalueReferenceType, dwarf.TagPtrToMemberType:
+			t.Pointer++
+		case dwarf.TagTypedef, dwarf.TagConstType, dwarf.TagVolatileType, dwarf.TagRestrictType, dwarf.TagAtomicType:
+		case dwarf.TagBaseType:
+			encoding, _ := e.Val(dwarf.AttrEncoding).(int64)
+			size, _ := e.Val(dwarf.AttrByteSize).(int64)
+			t.Base = gtutils.NormalizeBaseType(int(encoding), int(size))
+			return
+		case dwarf.TagStructType, dwarf.TagClassType:
+			t.Base = "struct"
+			return
+		case dwarf.TagUnionType:
+			t.Base = "union"
+			return
+		case dwarf.TagEnumerationType:
+			t.Base = "enum"
+			return
+		case dwarf.TagArrayType:
+			t.Base = "array"
+			return
+		case dwarf.TagSubroutineType:
+			t.Base = "function"
+			return
+		default:
+			t.Base = "unspecified"
+			return
+		}
+	}
+	return
+}
+
+// ElfPrototypes reads the prototypes of the functions in funcs from DWARF
+// DW_TAG_subprogram entries
+func ElfPrototypes(binFile string, funcs map[gtutils.FuncRow][]int, is64 bool) (prototypes []gtutils.PrototypeRow) {
+	f, err := elf.Open(binFile)
+	if err != nil {
+		fmt.Printf("\tWARNING: %s cannot be open as elf, prototypes are not resolved\n", binFile)
+		return
+	}
+	defer f.Close()
+	d, err := f.DWARF()
+	if err != nil {
+		// No debug information
+		return
+	}
+	defaultConvention := "cdecl"
+	if is64 {
+		defaultConvention = "sysv64"
+	}
+	isFuncStart := make(map[int]bool)
+	for fr := range funcs {
+		isFuncStart[fr.Start] = true
+	}
+	found := make(map[int]bool)
+	r := d.Reader()
+	for {
+		e, err := r.Next()
+		if err != nil || e == nil {
+			break
+		}
+		if e.Tag != dwarf.TagSubprogram {
+			continue
+		}
+		lowpc, ok := e.Val(dwarf.AttrLowpc).(uint64)
+		if !ok || !isFuncStart[int(lowpc)] || found[int(lowpc)] {
+			continue
+		}
+		found[int(lowpc)] = true
+		// Concrete instances may keep the types in their abstract origins
+		// or declarations
+		decls := []*dwarf.Entry{e}
+		for i := 0; i < len(decls) && i < 4; i++ {
+			for _, attr := range []dwarf.Attr{dwarf.AttrAbstractOrigin, dwarf.AttrSpecification} {
+				if ref, ok := decls[i].Val(attr).(dwarf.Offset); ok {
+					if decl := dwarfEntryAt(d, ref); decl != nil {
+						decls = append(decls, decl)
+					}
+				}
+			}
+		}
+		proto := gtutils.PrototypeRow{
+			FuncStart:         int(lowpc),
+			Params:            make([]gtutils.TypeRef, 0),
+			CallingConvention: defaultConvention,
+		}
+		var haveReturn bool
+		for _, decl := range decls {
+			if _, ok := decl.Val(dwarf.AttrType).(dwarf.Offset); ok && !haveReturn {
+				proto.Return = dwarfTypeRef(d, decl)
+				haveReturn = true
+			}
+			if cc, ok := decl.Val(dwarf.AttrCalling).(int64); ok {
+				if name, ok := dwarfCallingConventions[cc]; ok {
+					proto.CallingConvention = name
+				}
+			}
+		}
+		if !haveReturn {
+			proto.Return = gtutils.TypeRef{Base: "void"}
+		}
+		for _, decl := range decls {
+			var haveParams bool
+			for _, child := range dwarfChildren(d, decl) {
+				switch child.Tag {
+				case dwarf.TagFormalParameter:
+					haveParams = true
+					typed := child
+					if ref, ok := child.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset); ok {
+						if origin := dwarfEntryAt(d, ref); origin != nil {
+							typed = origin
+						}
+					}
+					proto.Params = append(proto.Params, dwarfTypeRef(d, typed))
+				case dwarf.TagUnspecifiedParameters:
+					haveParams = true
+					proto.Variadic = true
+				}
+			}
+			if haveParams {
+				break
+			}
+		}
+		prototypes = append(prototypes, proto)
+	}
+	sort.Slice(prototypes, func(i, j int) bool {
+		return prototypes[i].FuncStart < prototypes[j].FuncStart
+	})
+	return
+}
@@ -0,0 +1,675 @@
+package elfutils
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	gtutils "github.com/pangine/disasm-gt-generator/gtutils"
+)
+
+// objReloc is a relocation read from an elf object file
+type objReloc struct {
+	Section int // Index of the section the relocation applies to
+	Offset  int
+	Type    uint32
+	Size    int
+	Symbol  elf.Symbol
+	Addend  int
+}
+
+// relocSize returns the number of bytes modified by a relocation type, 0 if unknown
+func relocSize(machine elf.Machine, rType uint32) int {
+	switch machine {
+	case elf.EM_X86_64:
+		switch elf.R_X86_64(rType) {
+		case elf.R_X86_64_64, elf.R_X86_64_PC64, elf.R_X86_64_GOTOFF64:
+			return 8
+		case elf.R_X86_64_32, elf.R_X86_64_32S, elf.R_X86_64_PC32,
+			elf.R_X86_64_PLT32, elf.R_X86_64_GOTPCREL, elf.R_X86_64_GOTPCRELX,
+			elf.R_X86_64_REX_GOTPCRELX, elf.R_X86_64_GOTPC32, elf.R_X86_64_TPOFF32,
+			elf.R_X86_64_GOTTPOFF, elf.R_X86_64_TLSGD, elf.R_X86_64_TLSLD,
+			elf.R_X86_64_DTPOFF32:
+			return 4
+		case elf.R_X86_64_16, elf.R_X86_64_PC16:
+			return 2
+		case elf.R_X86_64_8, elf.R_X86_64_PC8:
+			return 1
+		}
+	case elf.EM_386:
+		switch elf.R_386(rType) {
+		case elf.R_386_32, elf.R_386_PC32, elf.R_386_GOT32, elf.R_386_PLT32,
+			elf.R_386_GOTOFF, elf.R_386_GOTPC, elf.R_386_GOT32X,
+			elf.R_386_TLS_GD, elf.R_386_TLS_LDM, elf.R_386_TLS_IE,
+			elf.R_386_TLS_GOTIE, elf.R_386_TLS_LE, elf.R_386_TLS_LDO_32:
+			return 4
+		case elf.R_386_16, elf.R_386_PC16:
+			return 2
+		case elf.R_386_8, elf.R_386_PC8:
+			return 1
+		}
+	}
+	return 0
+}
+
+// isPointerReloc returns true if the relocation stores an absolute address
+func isPointerReloc(machine elf.Machine, rType uint32) bool {
+	switch machine {
+	case elf.EM_X86_64:
+		return elf.R_X86_64(rType) == elf.R_X86_64_64 ||
+			elf.R_X86_64(rType) == elf.R_X86_64_32
+	case elf.EM_386:
+		return elf.R_386(rType) == elf.R_386_32
+	}
+	return false
+}
+
+// isSignedReloc returns true if the field of a relocation type is sign
+// extended when used, e.g. R_X86_64_32S and R_X86_64_TPOFF32, and false if it
+// is zero extended, e.g. R_X86_64_32
+func isSignedReloc(machine elf.Machine, rType uint32) bool {
+	switch machine {
+	case elf.EM_X86_64:
+		switch elf.R_X86_64(rType) {
+		case elf.R_X86_64_32, elf.R_X86_64_16, elf.R_X86_64_8:
+			return false
+		}
+	case elf.EM_386:
+		switch elf.R_386(rType) {
+		case elf.R_386_32, elf.R_386_16, elf.R_386_8,
+			elf.R_386_TLS_IE, elf.R_386_TLS_LDO_32:
+			return false
+		}
+	}
+	return true
+}
+
+// readObjRelocs reads all relocations in an elf object file.
+// Symbols are from symbol table "syms", which is the result of f.Symbols().
+func readObjRelocs(f *elf.File, syms []elf.Symbol) (relocs []objReloc) {
+	order := f.ByteOrder
+	for _, sec := range f.Sections {
+		if sec.Type != elf.SHT_RELA && sec.Type != elf.SHT_REL {
+			continue
+		}
+		if int(sec.Info) >= len(f.Sections) {
+			continue
+		}
+		target := f.Sections[sec.Info]
+		data, err := sec.Data()
+		if err != nil {
+			continue
+		}
+		var targetData []byte
+		if sec.Type == elf.SHT_REL && target.Type != elf.SHT_NOBITS {
+			// Addends of REL are stored in place
+			targetData, _ = target.Data()
+		}
+		reader := bytes.NewReader(data)
+		for reader.Len() > 0 {
+			var offset, addend int
+			var symIdx, rType uint32
+			if f.Class == elf.ELFCLASS64 {
+				if sec.Type == elf.SHT_RELA {
+					var r elf.Rela64
+					if binary.Read(reader, order, &r) != nil {
+						break
+					}
+					offset, addend = int(r.Off), int(r.Addend)
+					symIdx, rType = elf.R_SYM64(r.Info), elf.R_TYPE64(r.Info)
+				} else {
+					var r elf.Rel64
+					if binary.Read(reader, order, &r) != nil {
+						break
+					}
+					offset = int(r.Off)
+					symIdx, rType = elf.R_SYM64(r.Info), elf.R_TYPE64(r.Info)
+				}
+			} else {
+				if sec.Type == elf.SHT_RELA {
+					var r elf.Rela32
+					if binary.Read(reader, order, &r) != nil {
+						break
+					}
+					offset, addend = int(r.Off), int(r.Addend)
+					symIdx, rType = elf.R_SYM32(r.Info), elf.R_TYPE32(r.Info)
+				} else {
+					var r elf.Rel32
+					if binary.Read(reader, order, &r) != nil {
+						break
+					}
+					offset = int(r.Off)
+					symIdx, rType = elf.R_SYM32(r.Info), elf.R_TYPE32(r.Info)
+				}
+			}
+			size := relocSize(f.Machine, rType)
+			if size == 0 || symIdx == 0 || int(symIdx) > len(syms) {
+				continue
+			}
+			if targetData != nil && offset+size <= len(targetData) {
+				addend = readSigned(targetData[offset:], size, order)
+			}
+			relocs = append(relocs, objReloc{
+				Section: int(sec.Info),
+				Offset:  offset,
+				Type:    rType,
+				Size:    size,
+				Symbol:  syms[symIdx-1],
+				Addend:  addend,
+			})
+		}
+	}
+	return
+}
+
+// readSigned reads a signed integer of size bytes
+func readSigned(data []byte, size int, order binary.ByteOrder) int {
+	switch size {
+	case 8:
+		return int(int64(order.Uint64(data)))
+	case 4:
+		return int(int32(order.Uint32(data)))
+	case 2:
+		return int(int16(order.Uint16(data)))
+	}
+	return int(int8(data[0]))
+}
+
+// readUnsigned reads an unsigned integer of size bytes
+func readUnsigned(data []byte, size int, order binary.ByteOrder) int {
+	switch size {
+	case 8:
+		return int(order.Uint64(data))
+	case 4:
+		return int(order.Uint32(data))
+	case 2:
+		return int(order.Uint16(data))
+	}
+	return int(data[0])
+}
+
+// relocFuncName returns the name of the function a relocation points to,
+// empty if the target is not the start of a function
+func relocFuncName(r objReloc, syms []elf.Symbol) string {
+	switch elf.ST_TYPE(r.Symbol.Info) {
+	case elf.STT_FUNC, elf.STT_GNU_IFUNC:
+		if r.Addend == 0 {
+			return r.Symbol.Name
+		}
+	case elf.STT_SECTION:
+		// Local functions can be referenced by section + offset
+		for _, s := range syms {
+			if s.Section == r.Symbol.Section &&
+				elf.ST_TYPE(s.Info) == elf.STT_FUNC &&
+				int(s.Value) == r.Addend {
+				return s.Name
+			}
+		}
+	}
+	return ""
+}
+
+// binaryLayout is the information of a linked binary needed to map
+// object file contents onto it
+type binaryLayout struct {
+	order    binary.ByteOrder
+	ptrSize  int
+	sections []*elf.Section
+	data     map[*elf.Section][]byte
+	symbols  map[string][]int
+	relative map[int]int // Dynamic relative relocations: location -> value
+}
+
+// readBinaryLayout reads the sections and symbols of a linked binary
+func readBinaryLayout(binFile string) (layout *binaryLayout, err error) {
+	f, err := elf.Open(binFile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	layout = &binaryLayout{
+		order:    f.ByteOrder,
+		ptrSize:  4,
+		data:     make(map[*elf.Section][]byte),
+		symbols:  make(map[string][]int),
+		relative: make(map[int]int),
+	}
+	if f.Class == elf.ELFCLASS64 {
+		layout.ptrSize = 8
+	}
+	for _, sec := range f.Sections {
+		if sec.Flags&elf.SHF_ALLOC == 0 || sec.Type == elf.SHT_NOBITS {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			continue
+		}
+		layout.sections = append(layout.sections, sec)
+		layout.data[sec] = data
+	}
+	syms, _ := f.Symbols()
+	dynSyms, _ := f.DynamicSymbols()
+	for _, s := range append(syms, dynSyms...) {
+		if s.Section == elf.SHN_UNDEF || s.Value == 0 || s.Name == "" {
+			continue
+		}
+		layout.symbols[s.Name] = append(layout.symbols[s.Name], int(s.Value))
+	}
+	// Pointers in position independent binaries are set by relative relocations
+	for _, sec := range f.Sections {
+		if sec.Type != elf.SHT_RELA && sec.Type != elf.SHT_REL || sec.Flags&elf.SHF_ALLOC == 0 {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			continue
+		}
+		reader := bytes.NewReader(data)
+		for reader.Len() > 0 {
+			if f.Class == elf.ELFCLASS64 && sec.Type == elf.SHT_RELA {
+				var r elf.Rela64
+				if binary.Read(reader, f.ByteOrder, &r) != nil {
+					break
+				}
+				if elf.R_X86_64(elf.R_TYPE64(r.Info)) == elf.R_X86_64_RELATIVE {
+					layout.relative[int(r.Off)] = int(r.Addend)
+				}
+			} else if f.Class == elf.ELFCLASS32 && sec.Type == elf.SHT_RELA {
+				var r elf.Rela32
+				if binary.Read(reader, f.ByteOrder, &r) != nil {
+					break
+				}
+				if elf.R_386(elf.R_TYPE32(r.Info)) == elf.R_386_RELATIVE {
+					layout.relative[int(r.Off)] = int(r.Addend)
+				}
+			} else {
+				// Addends of REL are in place, nothing to record
+				break
+			}
+		}
+	}
+	return
+}
+
+// sectionAt returns the binary section containing addr
+func (l *binaryLayout) sectionAt(addr int) *elf.Section {
+	for _, sec := range l.sections {
+		if addr >= int(sec.Addr) && addr < int(sec.Addr+sec.Size) {
+			return sec
+		}
+	}
+	return nil
+}
+
+// sectionByName returns the binary section with the name
+func (l *binaryLayout) sectionByName(name string) *elf.Section {
+	for _, sec := range l.sections {
+		if sec.Name == name {
+			return sec
+		}
+	}
+	return nil
+}
+
+// bytesAt returns size bytes at virtual address addr
+func (l *binaryLayout) bytesAt(addr, size int) []byte {
+	sec := l.sectionAt(addr)
+	if sec == nil {
+		return nil
+	}
+	data := l.data[sec]
+	off := addr - int(sec.Addr)
+	if off+size > len(data) {
+		return nil
+	}
+	return data[off : off+size]
+}
+
+// pointerAt returns the address stored at addr
+func (l *binaryLayout) pointerAt(addr, size int) (value int, ok bool) {
+	if value, ok = l.relative[addr]; ok {
+		return
+	}
+	data := l.bytesAt(addr, size)
+	if data == nil {
+		return
+	}
+	if size == 8 {
+		return int(l.order.Uint64(data)), true
+	}
+	return int(l.order.Uint32(data)), true
+}
+
+// isSymbolAddr checks if addr is an address of symbol name
+func (l *binaryLayout) isSymbolAddr(name string, addr int) bool {
+	for _, a := range l.symbols[name] {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// locateObjSection searches for the address of an object section in the binary.
+// Candidates are derived from symbols defined in the section; if there is no
+// such symbol, the first relocation is searched in binary sections with a
+// matching name. check verifies a candidate.
+func (l *binaryLayout) locateObjSection(
+	sec *elf.Section,
+	secIdx int,
+	syms []elf.Symbol,
+	first objReloc, firstTarget string,
+	check func(base int) bool,
+) (base int, ok bool) {
+	tried := make(map[int]bool)
+	try := func(b int) bool {
+		if tried[b] {
+			return false
+		}
+		tried[b] = true
+		return check(b)
+	}
+	var haveSymbol bool
+	for _, s := range syms {
+		if int(s.Section) != secIdx || s.Name == "" ||
+			elf.ST_TYPE(s.Info) == elf.STT_SECTION || elf.ST_TYPE(s.Info) == elf.STT_FILE {
+			continue
+		}
+		haveSymbol = true
+		for _, addr := range l.symbols[s.Name] {
+			if try(addr - int(s.Value)) {
+				return addr - int(s.Value), true
+			}
+		}
+	}
+	if haveSymbol || firstTarget == "" {
+		return
+	}
+	for _, binSec := range l.sections {
+		if !strings.HasPrefix(sec.Name, binSec.Name) {
+			continue
+		}
+		for off := 0; off+first.Size <= int(binSec.Size); off += first.Size {
+			addr := int(binSec.Addr) + off
+			if value, ok := l.pointerAt(addr, first.Size); ok &&
+				l.isSymbolAddr(firstTarget, value) &&
+				try(addr-first.Offset) {
+				return addr - first.Offset, true
+			}
+		}
+	}
+	return
+}
+
+// AddressTaken finds function pointers stored in data sections using the
+// relocations in object files, and locates them in the linked binary
+func AddressTaken(objDir string, objFiles []string, binFile string) (rows []gtutils.AddressTakenRow) {
+	layout, err := readBinaryLayout(binFile)
+	if err != nil {
+		fmt.Printf("\tWARNING: %s cannot be open as elf, address taken functions are not resolved\n", binFile)
+		return
+	}
+	recorded := make(map[int]bool)
+	for _, obj := range objFiles {
+		of, err := elf.Open(filepath.Join(objDir, obj))
+		if err != nil {
+			fmt.Printf("\tWARNING: %s cannot be open as elf\n", obj)
+			continue
+		}
+		syms, _ := of.Symbols()
+		// Function pointers grouped by data sections
+		pointers := make(map[int][]objReloc)
+		targets := make(map[int][]string)
+		for _, r := range readObjRelocs(of, syms) {
+			sec := of.Sections[r.Section]
+			if sec.Flags&elf.SHF_ALLOC == 0 ||
+				sec.Flags&elf.SHF_EXECINSTR != 0 ||
+				strings.HasPrefix(sec.Name, ".eh_frame") ||
+				!isPointerReloc(of.Machine, r.Type) {
+				continue
+			}
+			name := relocFuncName(r, syms)
+			if name == "" {
+				continue
+			}
+			pointers[r.Section] = append(pointers[r.Section], r)
+			targets[r.Section] = append(targets[r.Section], name)
+		}
+		secIdxs := make([]int, 0, len(pointers))
+		for secIdx := range pointers {
+			secIdxs = append(secIdxs, secIdx)
+		}
+		sort.Ints(secIdxs)
+		for _, secIdx := range secIdxs {
+			relocs := pointers[secIdx]
+			names := targets[secIdx]
+			check := func(base int) bool {
+				for i, r := range relocs {
+					value, ok := layout.pointerAt(base+r.Offset, r.Size)
+					if !ok || !layout.isSymbolAddr(names[i], value) {
+						return false
+					}
+				}
+				return true
+			}
+			base, ok := layout.locateObjSection(of.Sections[secIdx], secIdx, syms,
+				relocs[0], names[0], check)
+			if !ok {
+				continue
+			}
+			for i, r := range relocs {
+				location := base + r.Offset
+				if recorded[location] {
+					continue
+				}
+				recorded[location] = true
+				sec := layout.sectionAt(location)
+				if sec == nil {
+					fmt.Printf("\tWARNING: pointer to %s at %x is not in any section of the binary\n", names[i], location)
+					continue
+				}
+				target, _ := layout.pointerAt(location, r.Size)
+				rows = append(rows, gtutils.AddressTakenRow{
+					Location:   location,
+					Size:       r.Size,
+					Section:    sec.Name,
+					Target:     target,
+					TargetName: names[i],
+				})
+			}
+		}
+		of.Close()
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Location < rows[j].Location
+	})
+	return
+}
+
+// relocTypeName returns the name of a relocation type
+func relocTypeName(machine elf.Machine, rType uint32) string {
+	switch machine {
+	case elf.EM_X86_64:
+		return elf.R_X86_64(rType).String()
+	case elf.EM_386:
+		return elf.R_386(rType).String()
+	}
+	return fmt.Sprintf("%d", rType)
+}
+
+// isPCRelReloc returns true if the relocated field is relative to its own location
+func isPCRelReloc(machine elf.Machine, rType uint32) bool {
+	switch machine {
+	case elf.EM_X86_64:
+		switch elf.R_X86_64(rType) {
+		case elf.R_X86_64_PC8, elf.R_X86_64_PC16, elf.R_X86_64_PC32, elf.R_X86_64_PC64,
+			elf.R_X86_64_PLT32, elf.R_X86_64_GOTPCREL, elf.R_X86_64_GOTPCRELX,
+			elf.R_X86_64_REX_GOTPCRELX, elf.R_X86_64_GOTTPOFF, elf.R_X86_64_TLSGD,
+			elf.R_X86_64_TLSLD:
+			return true
+		}
+	case elf.EM_386:
+		switch elf.R_386(rType) {
+		case elf.R_386_PC8, elf.R_386_PC16, elf.R_386_PC32, elf.R_386_PLT32, elf.R_386_GOTPC:
+			return true
+		}
+	}
+	return false
+}
+
+// relaxWindow returns the number of bytes before and after the relocated
+// field that the linker may rewrite when it relaxes the instruction, e.g.
+// GOTPCRELX mov to lea, indirect call to addr32 call, and TLS GD/LD/IE to LE
+func relaxWindow(machine elf.Machine, rType uint32) (before, after int) {
+	switch machine {
+	case elf.EM_X86_64:
+		switch elf.R_X86_64(rType) {
+		case elf.R_X86_64_GOTPCRELX, elf.R_X86_64_REX_GOTPCRELX, elf.R_X86_64_GOTTPOFF:
+			return 3, 0
+		case elf.R_X86_64_TLSGD:
+			// .byte 0x66; leaq x@tlsgd(%rip),%rdi; .word 0x6666; rex64; call
+			return 4, 8
+		case elf.R_X86_64_TLSLD:
+			// leaq x@tlsld(%rip),%rdi; call
+			return 3, 5
+		}
+	case elf.EM_386:
+		switch elf.R_386(rType) {
+		case elf.R_386_GOT32X, elf.R_386_TLS_IE, elf.R_386_TLS_GOTIE:
+			return 2, 0
+		case elf.R_386_TLS_GD, elf.R_386_TLS_LDM:
+			// leal x@tlsgd(,%ebx,1),%eax; call
+			return 3, 6
+		}
+	}
+	return 0, 0
+}
+
+// Symbolization maps the relocations in the code sections of object files onto
+// the ground truth instructions of the linked binary
+func Symbolization(
+	objDir string,
+	objFiles []string,
+	binFile string,
+	insts map[int]gtutils.InsnSupplementary,
+) (rows []gtutils.SymbolizationRow) {
+	layout, err := readBinaryLayout(binFile)
+	if err != nil {
+		fmt.Printf("\tWARNING: %s cannot be open as elf, operands are not symbolized\n", binFile)
+		return
+	}
+	insnLst := make([]int, 0, len(insts))
+	for offset := range insts {
+		insnLst = append(insnLst, offset)
+	}
+	sort.Ints(insnLst)
+	// insnAt returns the ground truth instruction containing addr
+	insnAt := func(addr int) (int, bool) {
+		i := sort.SearchInts(insnLst, addr+1) - 1
+		if i < 0 || insnLst[i]+insts[insnLst[i]].Length <= addr {
+			return 0, false
+		}
+		return insnLst[i], true
+	}
+	recorded := make(map[int]bool)
+	for _, obj := range objFiles {
+		of, err := elf.Open(filepath.Join(objDir, obj))
+		if err != nil {
+			fmt.Printf("\tWARNING: %s cannot be open as elf\n", obj)
+			continue
+		}
+		syms, _ := of.Symbols()
+		relocs := make(map[int][]objReloc)
+		for _, r := range readObjRelocs(of, syms) {
+			if of.Sections[r.Section].Flags&elf.SHF_EXECINSTR != 0 {
+				relocs[r.Section] = append(relocs[r.Section], r)
+			}
+		}
+		secIdxs := make([]int, 0, len(relocs))
+		for secIdx := range relocs {
+			secIdxs = append(secIdxs, secIdx)
+		}
+		sort.Ints(secIdxs)
+		for _, secIdx := range secIdxs {
+			sec := of.Sections[secIdx]
+			data, err := sec.Data()
+			if err != nil {
+				continue
+			}
+			// Bytes modified by the linker are not compared
+			relocated := make([]bool, len(data))
+			for _, r := range relocs[secIdx] {
+				before, after := relaxWindow(of.Machine, r.Type)
+				for i := r.Offset - before; i < r.Offset+r.Size+after && i < len(data); i++ {
+					if i >= 0 {
+						relocated[i] = true
+					}
+				}
+			}
+			check := func(base int) bool {
+				binData := layout.bytesAt(base, len(data))
+				if binData == nil {
+					return false
+				}
+				for i := range data {
+					if !relocated[i] && data[i] != binData[i] {
+						return false
+					}
+				}
+				return true
+			}
+			base, ok := layout.locateObjSection(sec, secIdx, syms, objReloc{}, "", check)
+			if !ok {
+				fmt.Printf("\tWARNING: %s of %s cannot be located in binary, its operands are not symbolized\n",
+					sec.Name, obj)
+				continue
+			}
+			for _, r := range relocs[secIdx] {
+				location := base + r.Offset
+				insn, ok := insnAt(location)
+				if !ok || recorded[location] {
+					continue
+				}
+				recorded[location] = true
+				target := -1
+				if field := layout.bytesAt(location, r.Size); field != nil {
+					value := readUnsigned(field, r.Size, layout.order)
+					if isSignedReloc(of.Machine, r.Type) {
+						value = readSigned(field, r.Size, layout.order)
+					}
+					if isPCRelReloc(of.Machine, r.Type) {
+						value += location
+					}
+					target = value - r.Addend
+				}
+				symbol := r.Symbol.Name
+				if elf.ST_TYPE(r.Symbol.Info) == elf.STT_SECTION &&
+					int(r.Symbol.Section) < len(of.Sections) {
+					symbol = of.Sections[r.Symbol.Section].Name
+				}
+				rows = append(rows, gtutils.SymbolizationRow{
+					Insn:          insn,
+					OperandOffset: location - insn,
+					Size:          r.Size,
+					Symbol:        symbol,
+					Addend:        r.Addend,
+					Target:        target,
+					Type:          relocTypeName(of.Machine, r.Type),
+				})
+			}
+		}
+		of.Close()
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Insn != rows[j].Insn {
+			return rows[i].Insn < rows[j].Insn
+		}
+		return rows[i].OperandOffset < rows[j].OperandOffset
+	})
+	return
+}
@@ -0,0 +1,39 @@
+package elfutils
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+)
+
+func TestIsSignedReloc(t *testing.T) {
+	tests := []struct {
+		machine elf.Machine
+		rType   uint32
+		want    bool
+	}{
+		{elf.EM_X86_64, uint32(elf.R_X86_64_32), false},
+		{elf.EM_X86_64, uint32(elf.R_X86_64_32S), true},
+		{elf.EM_X86_64, uint32(elf.R_X86_64_TPOFF32), true},
+		{elf.EM_X86_64, uint32(elf.R_X86_64_PC32), true},
+		{elf.EM_X86_64, uint32(elf.R_X86_64_GOTPCRELX), true},
+		{elf.EM_386, uint32(elf.R_386_32), false},
+		{elf.EM_386, uint32(elf.R_386_GOTOFF), true},
+		{elf.EM_386, uint32(elf.R_386_TLS_LE), true},
+	}
+	for _, tt := range tests {
+		if got := isSignedReloc(tt.machine, tt.rType); got != tt.want {
+			t.Errorf("isSignedReloc(%v, %d) = %v, want %v", tt.machine, tt.rType, got, tt.want)
+		}
+	}
+}
+
+func TestReadRelocField(t *testing.T) {
+	field := []byte{0xf0, 0xff, 0xff, 0xff}
+	if got := readSigned(field, 4, binary.LittleEndian); got != -0x10 {
+		t.Errorf("readSigned() = %#x, want -0x10", got)
+	}
+	if got := readUnsigned(field, 4, binary.LittleEndian); got != 0xfffffff0 {
+		t.Errorf("readUnsigned() = %#x, want 0xfffffff0", got)
+	}
+}
@@ -0,0 +1,194 @@
+package elfutils
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	gtutils "github.com/pangine/disasm-gt-generator/gtutils"
+)
+
+// thunkPrefixes are names of thunks generated without any listing
+var thunkPrefixes = []string{
+	"__x86.get_pc_thunk.",
+	"__x86_indirect_thunk",
+	"__x86_indirect_call_thunk",
+	"__x86_indirect_jump_thunk",
+	"__x86_return_thunk",
+	"__llvm_retpoline_",
+	"__llvm_lvi_thunk_",
+}
+
+// isThunkName checks if a symbol is a known compiler or linker thunk
+func isThunkName(name string) bool {
+	for _, prefix := range thunkPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// pltSlotNames reads the names of the GOT slots used by PLT entries from the
+// dynamic relocations. jumpSlots are JUMP_SLOT and IRELATIVE relocations in
+// the order of the PLT entries, globDats are GLOB_DAT relocations keyed by slot.
+func pltSlotNames(f *elf.File) (jumpSlots []string, globDats map[int]string) {
+	globDats = make(map[int]string)
+	dynSyms, _ := f.DynamicSymbols()
+	symName := func(idx uint32) string {
+		if idx == 0 || int(idx) > len(dynSyms) {
+			return ""
+		}
+		return dynSyms[idx-1].Name
+	}
+	for _, sec := range f.Sections {
+		if sec.Type != elf.SHT_RELA && sec.Type != elf.SHT_REL || sec.Flags&elf.SHF_ALLOC == 0 {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			continue
+		}
+		reader := bytes.NewReader(data)
+	readRelocs:
+		for reader.Len() > 0 {
+			var offset, addend int
+			var symIdx, rType uint32
+			switch {
+			case f.Class == elf.ELFCLASS64 && sec.Type == elf.SHT_RELA:
+				var r elf.Rela64
+				if binary.Read(reader, f.ByteOrder, &r) != nil {
+					break readRelocs
+				}
+				offset, addend = int(r.Off), int(r.Addend)
+				symIdx, rType = elf.R_SYM64(r.Info), elf.R_TYPE64(r.Info)
+			case f.Class == elf.ELFCLASS32 && sec.Type == elf.SHT_REL:
+				var r elf.Rel32
+				if binary.Read(reader, f.ByteOrder, &r) != nil {
+					break readRelocs
+				}
+				offset = int(r.Off)
+				symIdx, rType = elf.R_SYM32(r.Info), elf.R_TYPE32(r.Info)
+			default:
+				break readRelocs
+			}
+			var jumpSlot, irelative, globDat bool
+			if f.Machine == elf.EM_X86_64 {
+				jumpSlot = elf.R_X86_64(rType) == elf.R_X86_64_JMP_SLOT
+				irelative = elf.R_X86_64(rType) == elf.R_X86_64_IRELATIVE
+				globDat = elf.R_X86_64(rType) == elf.R_X86_64_GLOB_DAT
+			} else {
+				jumpSlot = elf.R_386(rType) == elf.R_386_JMP_SLOT
+				irelative = elf.R_386(rType) == elf.R_386_IRELATIVE
+				globDat = elf.R_386(rType) == elf.R_386_GLOB_DAT
+			}
+			switch {
+			case jumpSlot:
+				jumpSlots = append(jumpSlots, symName(symIdx))
+			case irelative && strings.HasSuffix(sec.Name, ".plt"):
+				jumpSlots = append(jumpSlots, fmt.Sprintf("*ABS*+0x%x", addend))
+			case globDat:
+				globDats[offset] = symName(symIdx)
+			}
+		}
+	}
+	return
+}
+
+// gotSlotOfEntry finds the GOT slot used by the rip relative indirect jump
+// in a PLT entry, -1 if there is none
+func gotSlotOfEntry(entry []byte, addr int) int {
+	idx := bytes.Index(entry, []byte{0xff, 0x25})
+	if idx < 0 || idx+6 > len(entry) {
+		return -1
+	}
+	disp := int(int32(binary.LittleEndian.Uint32(entry[idx+2:])))
+	return addr + idx + 6 + disp
+}
+
+// ElfLinkerStubs finds the linker generated stubs of an elf binary: entries of
+// .plt, .plt.sec and .plt.got, and thunks among the symbols that have no listing
+func ElfLinkerStubs(binFile string, noListing []gtutils.SymbolFuncInfo) (stubs []gtutils.CodeRange) {
+	for _, s := range noListing {
+		if isThunkName(s.Function) && s.Size > 0 {
+			stubs = append(stubs, gtutils.CodeRange{
+				Name:  s.Function,
+				Start: s.Offset,
+				End:   s.Offset + s.Size,
+			})
+		}
+	}
+
+	f, err := elf.Open(binFile)
+	if err != nil {
+		fmt.Printf("\tWARNING: %s cannot be open as elf, PLT entries are not resolved\n", binFile)
+		return
+	}
+	defer f.Close()
+	jumpSlots, globDats := pltSlotNames(f)
+	entries := func(name string, defaultSize int, firstNamed int) {
+		sec := f.Section(name)
+		if sec == nil || sec.Type == elf.SHT_NOBITS {
+			return
+		}
+		data, err := sec.Data()
+		if err != nil {
+			return
+		}
+		size := int(sec.Entsize)
+		if size == 0 || size > len(data) {
+			size = defaultSize
+		}
+		for i := 0; (i+1)*size <= len(data); i++ {
+			addr := int(sec.Addr) + i*size
+			var stubName string
+			if slot := i - firstNamed; firstNamed >= 0 && slot >= 0 && slot < len(jumpSlots) {
+				stubName = jumpSlots[slot] + "@plt"
+			} else if f.Machine == elf.EM_X86_64 {
+				if symbol, ok := globDats[gotSlotOfEntry(data[i*size:(i+1)*size], addr)]; ok && symbol != "" {
+					stubName = symbol + "@plt"
+				}
+			}
+			if stubName == "" {
+				stubName = fmt.Sprintf("%s+0x%x", name, i*size)
+			}
+			stubs = append(stubs, gtutils.CodeRange{
+				Name:  stubName,
+				Start: addr,
+				End:   addr + size,
+			})
+		}
+	}
+	if f.Section(".plt.sec") != nil {
+		// With IBT, .plt keeps the lazy binding code and .plt.sec the entries
+		entries(".plt", 16, -1)
+		entries(".plt.sec", 16, 0)
+	} else {
+		// The first entry of .plt is the lazy binding resolver
+		entries(".plt", 16, 1)
+	}
+	entries(".plt.got", 8, -1)
+	return
+}
+
+// ElfPatchSites reads the addresses of the nop sleds emitted by
+// -fpatchable-function-entry from __patchable_function_entries
+func ElfPatchSites(binFile string) (sites []int) {
+	layout, err := readBinaryLayout(binFile)
+	if err != nil {
+		return
+	}
+	for _, sec := range layout.sections {
+		if sec.Name != "__patchable_function_entries" {
+			continue
+		}
+		for addr := int(sec.Addr); addr+layout.ptrSize <= int(sec.Addr+sec.Size); addr += layout.ptrSize {
+			if site, ok := layout.pointerAt(addr, layout.ptrSize); ok && site != 0 {
+				sites = append(sites, site)
+			}
+		}
+	}
+	return
+}
@@ -87,6 +87,36 @@ func SymbolResolve(symbols string) (fmap []gtutils.SymbolFuncInfo) {
 	return
 }
 
+// DataObjectResolve resolves the defined OBJECT symbols of input symbol string
+func DataObjectResolve(symbols string) (objects []gtutils.DataObjectRow) {
+	objects = make([]gtutils.DataObjectRow, 0)
+	lines := bufio.NewScanner(strings.NewReader(symbols))
+	for lines.Scan() {
+		fields := strings.Split(lines.Text(), "|")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		if len(fields) != 7 {
+			continue
+		}
+		if strings.ToLower(fields[3]) != "object" {
+			continue
+		}
+		off64, _ := strconv.ParseUint(fields[1], 16, 64)
+		size64, _ := strconv.ParseUint(fields[4], 16, 64)
+		secName := fields[6]
+		if secTab := strings.Index(secName, "\t"); secTab >= 0 {
+			secName = secName[:secTab]
+		}
+		objects = append(objects, gtutils.DataObjectRow{
+			Name:    fields[0],
+			Start:   int(off64),
+			Size:    int(size64),
+			Section: secName})
+	}
+	return
+}
+
 func findSrcFile(fsrc string) (file string, line int) {
 	lastcolon := strings.LastIndex(fsrc, ":")
 	if lastcolon == -1 {
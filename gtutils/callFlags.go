@@ -0,0 +1,245 @@
+package utils
+
+import (
+	"sort"
+	"strings"
+)
+
+// noReturnNames are library functions known to never return
+var noReturnNames = map[string]bool{
+	"exit":                               true,
+	"_exit":                              true,
+	"_Exit":                              true,
+	"quick_exit":                         true,
+	"abort":                              true,
+	"longjmp":                            true,
+	"siglongjmp":                         true,
+	"__longjmp_chk":                      true,
+	"pthread_exit":                       true,
+	"__assert_fail":                      true,
+	"__assert_perror_fail":               true,
+	"__stack_chk_fail":                   true,
+	"__stack_chk_fail_local":             true,
+	"__fortify_fail":                     true,
+	"__chk_fail":                         true,
+	"__cxa_throw":                        true,
+	"__cxa_rethrow":                      true,
+	"__cxa_bad_cast":                     true,
+	"__cxa_bad_typeid":                   true,
+	"__cxa_pure_virtual":                 true,
+	"_Unwind_Resume":                     true,
+	"_ZSt9terminatev":                    true,
+	"ExitProcess":                        true,
+	"ExitThread":                         true,
+	"FatalExit":                          true,
+	"_CxxThrowException":                 true,
+	"__report_gsfailure":                 true,
+	"_invalid_parameter_noinfo_noreturn": true,
+	"__fastfail":                         true,
+}
+
+// importNoReturnNames are non-returning library functions whose names are
+// common enough to be reused by user functions. They are only trusted for
+// PLT entries and imports.
+var importNoReturnNames = map[string]bool{
+	"err":   true,
+	"errx":  true,
+	"verr":  true,
+	"verrx": true,
+}
+
+// IsNoReturnName checks if a symbol name is a known non-returning function.
+// imported tells if the name is a PLT entry or an import rather than a
+// function defined in the binary. Versions (exit@GLIBC_2.2.5), PLT suffixes
+// and leading underscores added by 32-bit Windows decoration are ignored.
+func IsNoReturnName(name string, imported bool) bool {
+	if i := strings.IndexByte(name, '@'); i > 0 {
+		name = name[:i]
+	}
+	known := func(name string) bool {
+		return noReturnNames[name] || imported && importNoReturnNames[name]
+	}
+	if known(name) {
+		return true
+	}
+	if strings.HasPrefix(name, "__imp_") {
+		return IsNoReturnName(strings.TrimPrefix(name, "__imp_"), true)
+	}
+	return strings.HasPrefix(name, "_") && known(name[1:])
+}
+
+// Kinds of exception handling funclets
+const (
+	FuncletCatch   = "catch"
+	FuncletUnwind  = "unwind"
+	FuncletFilter  = "filter"
+	FuncletFinally = "finally"
+)
+
+// Funclet is an exception handling funclet separated from its parent function
+type Funclet struct {
+	Kind   string
+	Parent int // Start of the parent function
+}
+
+// FuncAttr stores the per function flags recorded in the "func" table
+type FuncAttr struct {
+	NoReturn bool
+	TailCall bool    // The function contains at least one tail call
+	Funclet  Funclet // Empty Kind if the function is not a funclet
+	Producer string  // Compiler that generated the function
+	OptLevel string  // Optimization level in the compiler flags, e.g. "O2"
+	// Entry instrumentation
+	Endbr          bool // Starts with endbr64 or endbr32 (CET/IBT)
+	PatchableEntry bool // Has a patchable nop sled at or before its entry
+	Fentry         bool // Calls a profiling hook at its entry (-pg, -mfentry)
+	Hotpatch       bool // Starts with a hotpatchable instruction (MSVC /hotpatch)
+	BodyStart      int  // First instruction after the entry instrumentation
+}
+
+// AnnotateCalls labels tail calls and calls to non-returning functions, and
+// returns the per function flags keyed by function start.
+// A direct jmp to the start of another function is a tail call. A function
+// never returns if it is a known non-returning function, or it has no ret, no
+// indirect jump, no fallthrough out of its range, and only tail calls
+// non-returning functions. names supplements the function names with other
+// call targets, e.g. PLT entries and IAT slots, and slotRefs maps memory
+// indirect calls and jumps (call [__imp_X]) to the slots they go through.
+func AnnotateCalls(
+	insts map[int]InsnSupplementary,
+	funcs map[FuncRow][]int,
+	names map[int]string,
+	slotRefs map[int]int,
+) (attrs map[int]FuncAttr) {
+	attrs = make(map[int]FuncAttr)
+	targetNames := make(map[int]string)
+	for addr, name := range names {
+		targetNames[addr] = name
+	}
+	funcLst := make([]FuncRow, 0, len(funcs))
+	for f := range funcs {
+		funcLst = append(funcLst, f)
+		targetNames[f.Start] = f.Name
+	}
+	sort.Slice(funcLst, func(i, j int) bool {
+		return funcLst[i].Start < funcLst[j].Start
+	})
+
+	isFuncStart := make(map[int]bool)
+	for _, f := range funcLst {
+		isFuncStart[f.Start] = true
+	}
+	noReturn := make(map[int]bool)
+	for addr, name := range targetNames {
+		if IsNoReturnName(name, !isFuncStart[addr]) {
+			noReturn[addr] = true
+		}
+	}
+
+	// Tail calls
+	for _, f := range funcLst {
+		for _, offset := range funcs[f] {
+			supplementary := insts[offset]
+			if supplementary.Class != ClassJmp {
+				continue
+			}
+			for _, e := range supplementary.Edges {
+				if e.Kind == EdgeJump && e.Dst != f.Start && isFuncStart[e.Dst] {
+					supplementary.TailCall = true
+				}
+			}
+			if supplementary.TailCall {
+				insts[offset] = supplementary
+				attr := attrs[f.Start]
+				attr.TailCall = true
+				attrs[f.Start] = attr
+			}
+		}
+	}
+
+	// Non-returning functions, iterated until no more function is found
+	for changed := true; changed; {
+		changed = false
+		for _, f := range funcLst {
+			if noReturn[f.Start] || len(funcs[f]) == 0 || !neverReturns(f, funcs[f], insts, noReturn, slotRefs) {
+				continue
+			}
+			noReturn[f.Start] = true
+			changed = true
+		}
+	}
+
+	// Calls to non-returning functions
+	for _, f := range funcLst {
+		for _, offset := range funcs[f] {
+			supplementary := insts[offset]
+			switch supplementary.Class {
+			case ClassCall:
+				for _, e := range supplementary.Edges {
+					if e.Kind == EdgeCall && noReturn[e.Dst] {
+						supplementary.NoReturnCall = true
+					}
+				}
+			case ClassIndirect:
+				if slot, ok := slotRefs[offset]; ok && supplementary.IndirectCall && noReturn[slot] {
+					supplementary.NoReturnCall = true
+				}
+			}
+			if supplementary.NoReturnCall {
+				insts[offset] = supplementary
+			}
+		}
+		if noReturn[f.Start] {
+			attr := attrs[f.Start]
+			attr.NoReturn = true
+			attrs[f.Start] = attr
+		}
+	}
+	return
+}
+
+// neverReturns checks the instructions of function f for any way to return
+func neverReturns(
+	f FuncRow,
+	insnLst []int,
+	insts map[int]InsnSupplementary,
+	noReturn map[int]bool,
+	slotRefs map[int]int,
+) bool {
+	for _, offset := range insnLst {
+		supplementary := insts[offset]
+		if supplementary.Optional {
+			continue
+		}
+		slot, viaSlot := slotRefs[offset]
+		viaSlot = viaSlot && noReturn[slot]
+		switch supplementary.Class {
+		case ClassRet:
+			return false
+		case ClassIndirect:
+			if !supplementary.IndirectCall && !viaSlot {
+				return false
+			}
+		}
+		callsNoReturn := supplementary.IndirectCall && viaSlot
+		for _, e := range supplementary.Edges {
+			if e.Kind == EdgeCall && noReturn[e.Dst] {
+				callsNoReturn = true
+			}
+		}
+		for _, e := range supplementary.Edges {
+			if e.Dst >= f.Start && e.Dst < f.End {
+				continue
+			}
+			switch {
+			case e.Kind == EdgeCall:
+			case e.Kind == EdgeCallReturn && callsNoReturn:
+			case e.Kind == EdgeJump && noReturn[e.Dst]:
+			default:
+				// Leaving the function by a returning tail call or a fallthrough
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestIsNoReturnName(t *testing.T) {
+	tests := []struct {
+		name     string
+		imported bool
+		want     bool
+	}{
+		{"exit", false, true},
+		{"exit@GLIBC_2.2.5", true, true},
+		{"exit@plt", true, true},
+		{"abort@plt", true, true},
+		{"printf@plt", true, false},
+		{"__imp_ExitProcess", false, true},
+		{"__imp__ExitProcess@4", false, true},
+		{"__imp_GetLastError", false, false},
+		{"_ExitProcess@4", false, true},
+		{"__exit", false, true},
+		{"_printf", false, false},
+		{"err", false, false},
+		{"err", true, true},
+		{"err@plt", true, true},
+		{"__imp_errx", false, true},
+		{"_err", false, false},
+		{"main", false, false},
+	}
+	for _, tt := range tests {
+		if got := IsNoReturnName(tt.name, tt.imported); got != tt.want {
+			t.Errorf("IsNoReturnName(%q, %v) = %v, want %v", tt.name, tt.imported, got, tt.want)
+		}
+	}
+}
+
+func TestAnnotateCalls(t *testing.T) {
+	fail := FuncRow{Name: "fail", Start: 0x100, End: 0x108}
+	caller := FuncRow{Name: "caller", Start: 0x200, End: 0x210}
+	tail := FuncRow{Name: "tail", Start: 0x300, End: 0x305}
+	ret := FuncRow{Name: "ret", Start: 0x400, End: 0x401}
+	insts := map[int]InsnSupplementary{
+		// fail: call exit@plt; call [__imp_abort]
+		0x100: {Class: ClassCall, Edges: []InsnEdge{{0x105, EdgeCallReturn}, {0x50, EdgeCall}}},
+		0x105: {Class: ClassIndirect, IndirectCall: true, Edges: []InsnEdge{{0x108, EdgeCallReturn}}},
+		// caller: call fail; call ret; ret
+		0x200: {Class: ClassCall, Edges: []InsnEdge{{0x205, EdgeCallReturn}, {0x100, EdgeCall}}},
+		0x205: {Class: ClassCall, Edges: []InsnEdge{{0x20a, EdgeCallReturn}, {0x400, EdgeCall}}},
+		0x20a: {Class: ClassRet},
+		// tail: jmp fail
+		0x300: {Class: ClassJmp, Edges: []InsnEdge{{0x100, EdgeJump}}},
+		// ret: ret
+		0x400: {Class: ClassRet},
+	}
+	funcs := map[FuncRow][]int{
+		fail:   {0x100, 0x105},
+		caller: {0x200, 0x205, 0x20a},
+		tail:   {0x300},
+		ret:    {0x400},
+	}
+	names := map[int]string{0x50: "exit@plt", 0x60: "__imp_abort"}
+	slotRefs := map[int]int{0x105: 0x60}
+	attrs := AnnotateCalls(insts, funcs, names, slotRefs)
+
+	wantAttrs := map[int]FuncAttr{
+		fail.Start: {NoReturn: true},
+		tail.Start: {NoReturn: true, TailCall: true},
+	}
+	for _, f := range []FuncRow{fail, caller, tail, ret} {
+		if attrs[f.Start] != wantAttrs[f.Start] {
+			t.Errorf("attrs of %s = %+v, want %+v", f.Name, attrs[f.Start], wantAttrs[f.Start])
+		}
+	}
+	tests := []struct {
+		offset                 int
+		tailCall, noReturnCall bool
+	}{
+		{0x100, false, true},
+		{0x105, false, true},
+		{0x200, false, true},
+		{0x205, false, false},
+		{0x300, true, false},
+	}
+	for _, tt := range tests {
+		s := insts[tt.offset]
+		if s.TailCall != tt.tailCall || s.NoReturnCall != tt.noReturnCall {
+			t.Errorf("insn %x: TailCall = %v, NoReturnCall = %v, want %v, %v",
+				tt.offset, s.TailCall, s.NoReturnCall, tt.tailCall, tt.noReturnCall)
+		}
+	}
+}
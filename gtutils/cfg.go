@@ -0,0 +1,137 @@
+package utils
+
+import (
+	genutils "github.com/pangine/pangineDSM-utils/general"
+	pstruct "github.com/pangine/pangineDSM-utils/program-struct"
+)
+
+// Kinds of control flow edges stored in the "edge" table
+const (
+	EdgeFallthrough     = "fallthrough"
+	EdgeJump            = "jump"
+	EdgeCondTaken       = "cond-taken"
+	EdgeCondFallthrough = "cond-fallthrough"
+	EdgeCall            = "call"
+	EdgeCallReturn      = "call-return"
+	EdgeLandingPad      = "landing-pad" // From a call site to its exception handler
+)
+
+// InsnEdge is an outgoing control flow edge of an instruction
+type InsnEdge struct {
+	Dst  int
+	Kind string
+}
+
+// InstEdges computes the outgoing edges of an instruction using its successors.
+// "next" is the virtual address right after the instruction. The fallthrough
+// edge is decided by the instruction class, and the other successors are
+// branch targets, which may also be "next" (e.g. the i386 "call next" idiom).
+func InstEdges(insnType pstruct.InstFlags, next int) (edges []InsnEdge) {
+	class := InstClass(insnType)
+	var fallKind, targetKind string
+	switch class {
+	case ClassJcc:
+		fallKind, targetKind = EdgeCondFallthrough, EdgeCondTaken
+	case ClassCall:
+		fallKind, targetKind = EdgeCallReturn, EdgeCall
+	case ClassJmp:
+		targetKind = EdgeJump
+	case ClassIndirect:
+		if IsIndirectCall(insnType) {
+			fallKind = EdgeCallReturn
+		}
+	case ClassRet:
+	default:
+		if !insnType.IsHlt {
+			fallKind = EdgeFallthrough
+		}
+	}
+	var fallFound bool
+	targets := make([]int, 0)
+	for _, s := range genutils.InstSuccessors(insnType, next) {
+		if s == next && fallKind != "" && !fallFound {
+			fallFound = true
+			continue
+		}
+		targets = append(targets, s)
+	}
+	// Successors may be deduplicated, then a direct branch to the next
+	// instruction only leaves the fallthrough
+	if len(targets) == 0 && targetKind != "" && fallFound {
+		targets = append(targets, next)
+	}
+	if fallKind != "" {
+		edges = append(edges, InsnEdge{Dst: next, Kind: fallKind})
+	}
+	if targetKind != "" {
+		for _, t := range targets {
+			edges = append(edges, InsnEdge{Dst: t, Kind: targetKind})
+		}
+	}
+	return
+}
+
+// Origins of basic blocks stored in the "basic_block" table
+const (
+	// BlockLabel blocks start at a compiler generated label
+	BlockLabel = "label"
+	// BlockSplit blocks start after a control transfer instruction
+	BlockSplit = "split"
+	// BlockGap blocks start after a gap or an overlap between instructions
+	BlockGap = "gap"
+	// BlockTarget blocks start at a branch target without a label, e.g. one
+	// found by the aggressive search or in linker and library code
+	BlockTarget = "target"
+)
+
+// BasicBlockRow stores the information required to create the "basic_block" table
+type BasicBlockRow struct {
+	Start     int
+	End       int
+	InsnCount int
+	Origin    string
+}
+
+// BranchTargets collects the destinations of all non-fallthrough edges
+func BranchTargets(insns map[int]InsnSupplementary) (targets map[int]bool) {
+	targets = make(map[int]bool)
+	for _, supplementary := range insns {
+		for _, e := range supplementary.Edges {
+			if e.Kind != EdgeFallthrough && e.Kind != EdgeCondFallthrough && e.Kind != EdgeCallReturn {
+				targets[e.Dst] = true
+			}
+		}
+	}
+	return
+}
+
+// BasicBlocks splits the sorted instructions of a function into basic blocks
+// at LST labels, control transfer instructions and branch targets
+func BasicBlocks(insnLst []int, insns map[int]InsnSupplementary, targets map[int]bool) (blocks []BasicBlockRow) {
+	blocks = make([]BasicBlockRow, 0)
+	var lastClass string
+	var lastEnd int
+	for i, offset := range insnLst {
+		supplementary := insns[offset]
+		var origin string
+		switch {
+		case i == 0 || supplementary.LabelStart:
+			origin = BlockLabel
+		case IsControlTransfer(lastClass):
+			origin = BlockSplit
+		case offset != lastEnd:
+			origin = BlockGap
+		case targets[offset]:
+			origin = BlockTarget
+		}
+		if origin != "" {
+			blocks = append(blocks, BasicBlockRow{Start: offset, Origin: origin})
+		}
+		b := &blocks[len(blocks)-1]
+		b.End = offset + supplementary.Length
+		b.InsnCount++
+		lastClass = supplementary.Class
+		lastEnd = b.End
+	}
+	return
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	pstruct "github.com/pangine/pangineDSM-utils/program-struct"
+)
+
+func TestInstEdges(t *testing.T) {
+	const next = 0x1005
+	tests := []struct {
+		name  string
+		insn  pstruct.InstFlags
+		edges []InsnEdge
+	}{
+		{"other", pstruct.InstFlags{OriginInst: "movl %eax, %ebx"},
+			[]InsnEdge{{next, EdgeFallthrough}}},
+		{"nop", pstruct.InstFlags{IsNop: true, OriginInst: "nop"},
+			[]InsnEdge{{next, EdgeFallthrough}}},
+		{"hlt", pstruct.InstFlags{IsHlt: true, OriginInst: "hlt"},
+			nil},
+		{"ret", pstruct.InstFlags{IsRet: true, OriginInst: "retq"},
+			nil},
+		{"jmp", pstruct.InstFlags{IsJmp: true, OriginInst: "jmp 0x2000"},
+			[]InsnEdge{{0x2000, EdgeJump}}},
+		{"jmp next", pstruct.InstFlags{IsJmp: true, OriginInst: "jmp 0x1005"},
+			[]InsnEdge{{next, EdgeJump}}},
+		{"jcc", pstruct.InstFlags{IsJmp: true, IsConditional: true, OriginInst: "je 0x2000"},
+			[]InsnEdge{{next, EdgeCondFallthrough}, {0x2000, EdgeCondTaken}}},
+		{"call", pstruct.InstFlags{IsCall: true, OriginInst: "callq 0x2000"},
+			[]InsnEdge{{next, EdgeCallReturn}, {0x2000, EdgeCall}}},
+		{"call next", pstruct.InstFlags{IsCall: true, OriginInst: "calll 0x1005"},
+			[]InsnEdge{{next, EdgeCallReturn}, {next, EdgeCall}}},
+		{"indirect call", pstruct.InstFlags{IsCall: true, IsIndJmp: true, OriginInst: "callq *%rax"},
+			[]InsnEdge{{next, EdgeCallReturn}}},
+		{"indirect jmp", pstruct.InstFlags{IsJmp: true, IsIndJmp: true, OriginInst: "jmpq *%rax"},
+			nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if edges := InstEdges(tt.insn, next); !reflect.DeepEqual(edges, tt.edges) {
+				t.Errorf("InstEdges() = %v, want %v", edges, tt.edges)
+			}
+		})
+	}
+}
+
+func TestBasicBlocks(t *testing.T) {
+	insns := map[int]InsnSupplementary{
+		0x10: {Length: 2, Class: ClassOther},
+		0x12: {Length: 2, Class: ClassJcc, Edges: []InsnEdge{{0x14, EdgeCondFallthrough}, {0x18, EdgeCondTaken}}},
+		0x14: {Length: 4, Class: ClassOther},
+		0x18: {Length: 1, Class: ClassOther}, // Jcc target without a label
+		0x19: {Length: 1, Class: ClassRet},
+		0x20: {Length: 2, Class: ClassOther, LabelStart: true},
+		0x24: {Length: 1, Class: ClassRet}, // After a gap
+	}
+	tests := []struct {
+		name    string
+		insnLst []int
+		blocks  []BasicBlockRow
+	}{
+		{"split at target", []int{0x10, 0x12, 0x14, 0x18, 0x19}, []BasicBlockRow{
+			{0x10, 0x14, 2, BlockLabel},
+			{0x14, 0x18, 1, BlockSplit},
+			{0x18, 0x1a, 2, BlockTarget},
+		}},
+		{"label and gap", []int{0x19, 0x20, 0x24}, []BasicBlockRow{
+			{0x19, 0x1a, 1, BlockLabel},
+			{0x20, 0x22, 1, BlockLabel},
+			{0x24, 0x25, 1, BlockGap},
+		}},
+		{"empty", nil, []BasicBlockRow{}},
+	}
+	targets := BranchTargets(insns)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if blocks := BasicBlocks(tt.insnLst, insns, targets); !reflect.DeepEqual(blocks, tt.blocks) {
+				t.Errorf("BasicBlocks() = %v, want %v", blocks, tt.blocks)
+			}
+		})
+	}
+}
+
+func TestInstClass(t *testing.T) {
+	tests := []struct {
+		name         string
+		insn         pstruct.InstFlags
+		class        string
+		indirectCall bool
+	}{
+		{"call", pstruct.InstFlags{IsCall: true, OriginInst: "callq 0x401000"}, ClassCall, false},
+		{"call register", pstruct.InstFlags{IsCall: true, OriginInst: "callq *%rax"}, ClassIndirect, true},
+		{"call memory", pstruct.InstFlags{IsCall: true, OriginInst: "call qword ptr [rip + 0x10]"}, ClassIndirect, true},
+		{"notrack call", pstruct.InstFlags{IsCall: true, OriginInst: "notrack call rax"}, ClassIndirect, true},
+		{"jmp register", pstruct.InstFlags{IsJmp: true, IsIndJmp: true, OriginInst: "jmpq *%rax"}, ClassIndirect, false},
+		{"jcc", pstruct.InstFlags{IsJmp: true, IsConditional: true, OriginInst: "jne 0x10"}, ClassJcc, false},
+		{"ret", pstruct.InstFlags{IsRet: true, OriginInst: "retq"}, ClassRet, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if class := InstClass(tt.insn); class != tt.class {
+				t.Errorf("InstClass() = %s, want %s", class, tt.class)
+			}
+			if indirectCall := IsIndirectCall(tt.insn); indirectCall != tt.indirectCall {
+				t.Errorf("IsIndirectCall() = %v, want %v", indirectCall, tt.indirectCall)
+			}
+		})
+	}
+}
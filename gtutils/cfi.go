@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+
+	pstruct "github.com/pangine/pangineDSM-utils/program-struct"
+)
+
+// DWARF register numbers of x86 and x86_64
+var (
+	dwarfRegs32 = []string{"eax", "ecx", "edx", "ebx", "esp", "ebp", "esi", "edi", "eip"}
+	dwarfRegs64 = []string{"rax", "rdx", "rcx", "rbx", "rsi", "rdi", "rbp", "rsp",
+		"r8", "r9", "r10", "r11", "r12", "r13", "r14", "r15", "rip"}
+)
+
+// CfaState is the call frame information in effect at an instruction.
+// The CFA is Register+Offset, and Saved maps registers to the offsets of
+// their save slots from the CFA. An empty Register means the CFA is given
+// by an expression (.cfi_escape).
+type CfaState struct {
+	Register string
+	Offset   int
+	Saved    map[string]int
+}
+
+// initialCfaState is the state at function entry, after the call pushes the
+// return address
+func initialCfaState(is64 bool) *CfaState {
+	if is64 {
+		return &CfaState{Register: "rsp", Offset: 8, Saved: map[string]int{"rip": -8}}
+	}
+	return &CfaState{Register: "esp", Offset: 4, Saved: map[string]int{"eip": -4}}
+}
+
+// copy returns a state that can be modified without changing s
+func (s *CfaState) copy() *CfaState {
+	c := &CfaState{Register: s.Register, Offset: s.Offset, Saved: make(map[string]int)}
+	for r, off := range s.Saved {
+		c.Saved[r] = off
+	}
+	return c
+}
+
+// cfiRegister normalizes a register operand, either a name or a DWARF number
+func cfiRegister(operand string, is64 bool) string {
+	operand = strings.TrimPrefix(strings.TrimSuffix(operand, ","), "%")
+	if num, err := strconv.Atoi(operand); err == nil {
+		regs := dwarfRegs32
+		if is64 {
+			regs = dwarfRegs64
+		}
+		if num >= 0 && num < len(regs) {
+			return regs[num]
+		}
+	}
+	return operand
+}
+
+// cfiInt parses an integer operand of a CFI directive
+func cfiInt(operand string) int {
+	value, _ := strconv.ParseInt(strings.TrimSuffix(operand, ","), 0, 64)
+	return int(value)
+}
+
+// cfaInterpreter applies CFI directives of a function in order
+type cfaInterpreter struct {
+	is64       bool
+	state      *CfaState
+	remembered []*CfaState
+}
+
+// apply executes one directive, e.g. ".cfi_offset 6, -16"
+func (c *cfaInterpreter) apply(directive string) {
+	fields := strings.Fields(directive)
+	if len(fields) == 0 {
+		return
+	}
+	arg := func(i int) string {
+		if i+1 < len(fields) {
+			return fields[i+1]
+		}
+		return ""
+	}
+	if fields[0] == ".cfi_startproc" {
+		c.state = initialCfaState(c.is64)
+		c.remembered = nil
+		return
+	}
+	if c.state == nil {
+		return
+	}
+	next := c.state.copy()
+	switch fields[0] {
+	case ".cfi_def_cfa":
+		next.Register, next.Offset = cfiRegister(arg(0), c.is64), cfiInt(arg(1))
+	case ".cfi_def_cfa_register":
+		next.Register = cfiRegister(arg(0), c.is64)
+	case ".cfi_def_cfa_offset":
+		next.Offset = cfiInt(arg(0))
+	case ".cfi_adjust_cfa_offset":
+		next.Offset += cfiInt(arg(0))
+	case ".cfi_offset":
+		next.Saved[cfiRegister(arg(0), c.is64)] = cfiInt(arg(1))
+	case ".cfi_rel_offset":
+		// Relative to the CFA register instead of the CFA
+		next.Saved[cfiRegister(arg(0), c.is64)] = cfiInt(arg(1)) - next.Offset
+	case ".cfi_restore":
+		reg := cfiRegister(arg(0), c.is64)
+		if off, ok := initialCfaState(c.is64).Saved[reg]; ok {
+			next.Saved[reg] = off
+		} else {
+			delete(next.Saved, reg)
+		}
+	case ".cfi_undefined", ".cfi_same_value", ".cfi_register":
+		delete(next.Saved, cfiRegister(arg(0), c.is64))
+	case ".cfi_remember_state":
+		c.remembered = append(c.remembered, c.state)
+		return
+	case ".cfi_restore_state":
+		if n := len(c.remembered); n > 0 {
+			c.state = c.remembered[n-1]
+			c.remembered = c.remembered[:n-1]
+		}
+		return
+	case ".cfi_escape":
+		// Usually a CFA expression for stack realignment
+		next.Register, next.Offset = "", 0
+	default:
+		return
+	}
+	c.state = next
+}
+
+// ResolveCfa interprets the CFI directives of a matched function starting at
+// virtual address funcStart, and attaches the state to its instructions
+func ResolveCfa(
+	f *LstFunc,
+	funcStart int,
+	bi pstruct.BinaryInfo,
+	is64 bool,
+	insts map[int]InsnSupplementary,
+) {
+	headers := bi.ProgramHeaders
+	phyFuncStart := pstruct.V2PConv(headers, funcStart)
+	c := &cfaInterpreter{is64: is64}
+	for _, insn := range f.InsnAry {
+		for _, directive := range insn.Cfi {
+			c.apply(directive)
+		}
+		if c.state == nil {
+			continue
+		}
+		// Align insns can be decoded into several pieces
+		for phy := phyFuncStart + insn.Offset; phy < phyFuncStart+insn.Offset+insn.Length; phy++ {
+			addr := pstruct.P2VConv(headers, phy)
+			if supplementary, ok := insts[addr]; ok {
+				supplementary.Cfa = c.state
+				insts[addr] = supplementary
+			}
+		}
+	}
+}
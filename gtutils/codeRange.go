@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+
+	mcclient "github.com/pangine/pangineDSM-utils/mcclient"
+	objectapi "github.com/pangine/pangineDSM-utils/objectAPI"
+	pstruct "github.com/pangine/pangineDSM-utils/program-struct"
+)
+
+// CodeRange is a piece of code no listing describes, e.g. a linker generated
+// PLT entry, a thunk, an import jump stub, or a matched library function
+type CodeRange struct {
+	Name  string
+	Start int
+	End   int
+}
+
+// DecodeCodeRanges linearly decodes code ranges and adds them as functions
+// with instructions of the origin. Ranges starting at existing functions are
+// skipped, and decoding stops at existing instructions.
+func DecodeCodeRanges(
+	ranges []CodeRange,
+	origin string,
+	insts map[int]InsnSupplementary,
+	funcs map[FuncRow][]int,
+	bi pstruct.BinaryInfo,
+	obj objectapi.Object,
+) {
+	funcStarts := make(map[int]bool)
+	for f := range funcs {
+		funcStarts[f.Start] = true
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].Start < ranges[j].Start
+	})
+	for _, r := range ranges {
+		if funcStarts[r.Start] || r.End <= r.Start {
+			continue
+		}
+		rangeInsts := make(map[int]InsnSupplementary)
+		var index int
+		for offset := r.Start; offset < r.End; index++ {
+			if _, ok := insts[offset]; ok {
+				break
+			}
+			if !pstruct.VAisValid(bi.ProgramHeaders, offset) {
+				break
+			}
+			phyIP := pstruct.V2PConv(bi.ProgramHeaders, offset)
+			if phyIP < 0 || phyIP > len(bi.Sections.Data) {
+				break
+			}
+			res := mcclient.SendResolve(phyIP, bi.Sections.Data)
+			if !res.IsInst() || res.TakeBytes() == 0 {
+				break
+			}
+			insnStr, err := res.Inst()
+			if err != nil {
+				insnStr = "##INST"
+			}
+			insnLength := int(res.TakeBytes())
+			next := pstruct.P2VConv(bi.ProgramHeaders, phyIP+insnLength)
+			if next > r.End {
+				break
+			}
+			insnType := obj.TypeInst(insnStr, insnLength)
+			rangeInsts[offset] = InsnSupplementary{
+				Mnemonic:     InstMnemonic(insnType),
+				Class:        InstClass(insnType),
+				IndirectCall: IsIndirectCall(insnType),
+				Edges:        InstEdges(insnType, next),
+				Length:       insnLength,
+				LabelStart:   offset == r.Start,
+				Provenance: Provenance{
+					Origin:      origin,
+					Label:       r.Name,
+					Index:       index,
+					Predecessor: -1,
+				},
+			}
+			offset = next
+		}
+		if len(rangeInsts) == 0 {
+			fmt.Printf("\tWARNING: %s code %s at %x cannot be decoded\n", origin, r.Name, r.Start)
+			continue
+		}
+		insnLst := make([]int, 0, len(rangeInsts))
+		for offset, supplementary := range rangeInsts {
+			insts[offset] = supplementary
+			insnLst = append(insnLst, offset)
+		}
+		funcs[FuncRow{
+			Name:  r.Name,
+			Start: r.Start,
+			End:   r.End,
+		}] = insnLst
+		funcStarts[r.Start] = true
+	}
+}
@@ -0,0 +1,227 @@
+package utils
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	pstruct "github.com/pangine/pangineDSM-utils/program-struct"
+)
+
+// PaddingEntry are bytes reserved before a function start for patching,
+// e.g. by -fpatchable-function-entry=N,M or MSVC /hotpatch
+const PaddingEntry = "entry"
+
+// Instructions marking function entries
+var (
+	endbr64 = []byte{0xf3, 0x0f, 0x1e, 0xfa}
+	endbr32 = []byte{0xf3, 0x0f, 0x1e, 0xfb}
+	// Two byte instructions that a hotpatch overwrites with a short jmp
+	hotpatchInsns = [][]byte{
+		{0x8b, 0xff}, // mov edi, edi
+		{0x66, 0x90}, // xchg ax, ax
+		{0x48, 0x8d, 0xa4, 0x24, 0x00, 0x00, 0x00, 0x00}, // lea rsp, [rsp]
+	}
+)
+
+// profileNames are the profiling hooks called at function entries
+var profileNames = map[string]bool{
+	"__fentry__":               true,
+	"mcount":                   true,
+	"_mcount":                  true,
+	"__mcount":                 true,
+	".mcount":                  true,
+	"__cyg_profile_func_enter": true,
+	"_penter":                  true,
+}
+
+// functionPadMin is the padding x64 MSVC reserves before every function of a
+// /hotpatch image (/FUNCTIONPADMIN) for the long jmp to the patch
+const functionPadMin = 6
+
+// minSledNops is the number of nops at an entry that make a patchable sled
+// when the binary does not list its patchable entries
+const minSledNops = 2
+
+// maxProfileInsn is the number of instructions at an entry searched for a
+// profiling call, which -pg places after the frame setup
+const maxProfileInsn = 4
+
+// ResolveEntries detects the instrumentation at function entries and sets the
+// entry flags and the first real instruction of every function in attrs.
+// patchSites are the addresses of patchable nop sleds listed by the binary,
+// if any. It returns the entry padding regions before function starts, which
+// shall be passed to FillPadding. names supplements the function names with
+// other call targets, e.g. PLT entries. padMin tells to look for x64 MSVC
+// /hotpatch images, whose functions have no hotpatch instruction but are all
+// preceded by the /FUNCTIONPADMIN padding.
+func ResolveEntries(
+	attrs map[int]FuncAttr,
+	insts map[int]InsnSupplementary,
+	funcs map[FuncRow][]int,
+	names map[int]string,
+	patchSites []int,
+	padMin bool,
+	bi pstruct.BinaryInfo,
+) (padding []PaddingRow) {
+	headers := bi.ProgramHeaders
+	data := bi.Sections.Data
+	bytesAt := func(addr, size int) []byte {
+		phy := pstruct.V2PConv(headers, addr)
+		if phy < 0 || phy+size > len(data) {
+			return nil
+		}
+		return data[phy : phy+size]
+	}
+	targetNames := make(map[int]string)
+	for addr, name := range names {
+		targetNames[addr] = name
+	}
+	funcLst := make([]FuncRow, 0, len(funcs))
+	for f := range funcs {
+		funcLst = append(funcLst, f)
+		targetNames[f.Start] = f.Name
+	}
+	sort.Slice(funcLst, func(i, j int) bool {
+		return funcLst[i].Start < funcLst[j].Start
+	})
+	sites := append([]int(nil), patchSites...)
+	sort.Ints(sites)
+	// isPadding checks if the size bytes before addr are int3 or nop padding
+	isPadding := func(addr, size int) bool {
+		pad := bytesAt(addr-size, size)
+		return pad != nil && (bytes.Count(pad, []byte{0xcc}) == size || bytes.Count(pad, []byte{0x90}) == size)
+	}
+	// /FUNCTIONPADMIN reserves the padding before every function, while the
+	// alignment padding of other images is shorter before some of them.
+	// Linker and library code is not compiled with /hotpatch.
+	if padMin {
+		var padded, prevEnd int
+		for _, f := range funcLst {
+			switch insts[f.Start].Provenance.Origin {
+			case OriginLinker, OriginLibrary:
+				continue
+			}
+			if padded > 0 && (f.Start-prevEnd < functionPadMin || !isPadding(f.Start, functionPadMin)) {
+				padMin = false
+				break
+			}
+			padded++
+			prevEnd = f.End
+		}
+		padMin = padMin && padded > 2
+	}
+
+	for i, f := range funcLst {
+		prevEnd := 0
+		if i > 0 {
+			prevEnd = funcLst[i-1].End
+		}
+		insnLst := append([]int(nil), funcs[f]...)
+		sort.Ints(insnLst)
+		attr := attrs[f.Start]
+		idx := 0
+		if idx < len(insnLst) && insnLst[idx] == f.Start {
+			if b := bytesAt(f.Start, len(endbr64)); bytes.Equal(b, endbr64) || bytes.Equal(b, endbr32) {
+				attr.Endbr = true
+				idx++
+			}
+		}
+
+		// Patchable nop sleds listed by the binary, at or before the entry
+		var sledAtEntry bool
+		site := sort.SearchInts(sites, prevEnd)
+		for ; site < len(sites) && sites[site] < f.End; site++ {
+			if sites[site] > f.Start && (idx >= len(insnLst) || sites[site] != insnLst[idx]) {
+				continue
+			}
+			attr.PatchableEntry = true
+			if idx < len(insnLst) && sites[site] == insnLst[idx] {
+				sledAtEntry = true
+			}
+			if sites[site] < f.Start {
+				padding = append(padding, PaddingRow{
+					FuncStart: f.Start,
+					Start:     sites[site],
+					End:       f.Start,
+					Location:  PaddingEntry,
+				})
+			}
+		}
+
+		if idx < len(insnLst) && !sledAtEntry {
+			for _, insn := range hotpatchInsns {
+				if !bytes.Equal(bytesAt(insnLst[idx], len(insn)), insn) {
+					continue
+				}
+				// The long jmp to the patch is written in the padding before
+				// the function, 5 bytes for mov edi, edi and 6 bytes otherwise.
+				// Without the padding, it is an ordinary instruction.
+				size := 6
+				if insn[0] == 0x8b {
+					size = 5
+				}
+				if f.Start-size >= prevEnd && isPadding(f.Start, size) {
+					attr.Hotpatch = true
+					idx++
+					padding = append(padding, PaddingRow{
+						FuncStart: f.Start,
+						Start:     f.Start - size,
+						End:       f.Start,
+						Location:  PaddingEntry,
+					})
+				}
+				break
+			}
+			// x64 /hotpatch only makes the first instruction at least 2 bytes
+			if !attr.Hotpatch && padMin && insts[insnLst[idx]].Length >= 2 {
+				attr.Hotpatch = true
+				padding = append(padding, PaddingRow{
+					FuncStart: f.Start,
+					Start:     f.Start - functionPadMin,
+					End:       f.Start,
+					Location:  PaddingEntry,
+				})
+			}
+		}
+
+		// Nops at the entry are the patchable part of the sled, either listed
+		// by the binary or long enough not to be a single alignment nop
+		nops := 0
+		for idx+nops < len(insnLst) && insts[insnLst[idx+nops]].Class == ClassNop {
+			nops++
+		}
+		if sledAtEntry || nops >= minSledNops {
+			attr.PatchableEntry = attr.PatchableEntry || nops > 0
+			idx += nops
+		}
+
+		// Profiling calls, right at the entry with -mfentry
+		for j := idx; j < len(insnLst) && j < idx+maxProfileInsn; j++ {
+			supplementary := insts[insnLst[j]]
+			if supplementary.Class != ClassCall {
+				continue
+			}
+			for _, e := range supplementary.Edges {
+				name := targetNames[e.Dst]
+				if at := strings.IndexByte(name, '@'); at > 0 {
+					name = name[:at]
+				}
+				if e.Kind == EdgeCall && profileNames[name] {
+					attr.Fentry = true
+				}
+			}
+			if attr.Fentry && j == idx {
+				idx++
+			}
+			break
+		}
+
+		attr.BodyStart = f.Start
+		if idx < len(insnLst) {
+			attr.BodyStart = insnLst[idx]
+		}
+		attrs[f.Start] = attr
+	}
+	return
+}
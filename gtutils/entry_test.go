@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	pstruct "github.com/pangine/pangineDSM-utils/program-struct"
+)
+
+func TestResolveEntriesHotpatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		pad      byte // Bytes before the function
+		hotpatch bool
+		padding  []PaddingRow
+	}{
+		{"int3 padding", 0xcc, true, []PaddingRow{{FuncStart: 0x10, Start: 0x0b, End: 0x10, Location: PaddingEntry}}},
+		{"nop padding", 0x90, true, []PaddingRow{{FuncStart: 0x10, Start: 0x0b, End: 0x10, Location: PaddingEntry}}},
+		{"no padding", 0x00, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := make([]uint8, 0x20)
+			for i := 0x08; i < 0x10; i++ {
+				data[i] = tt.pad
+			}
+			copy(data[0x10:], []byte{0x8b, 0xff, 0x55}) // mov edi, edi; push ebp
+			bi := pstruct.BinaryInfo{Sections: pstruct.Sections{Data: data}}
+			insts := map[int]InsnSupplementary{
+				0x00: {Length: 8, Class: ClassOther},
+				0x10: {Length: 2, Class: ClassOther},
+				0x12: {Length: 1, Class: ClassOther},
+			}
+			funcs := map[FuncRow][]int{
+				{Name: "prev", Start: 0x00, End: 0x08}: {0x00},
+				{Name: "f", Start: 0x10, End: 0x13}:    {0x10, 0x12},
+			}
+			attrs := make(map[int]FuncAttr)
+			padding := ResolveEntries(attrs, insts, funcs, nil, nil, false, bi)
+			wantBody := 0x10
+			if tt.hotpatch {
+				wantBody = 0x12
+			}
+			if attr := attrs[0x10]; attr.Hotpatch != tt.hotpatch || attr.BodyStart != wantBody {
+				t.Errorf("Hotpatch = %v, BodyStart = %x, want %v, %x", attr.Hotpatch, attr.BodyStart, tt.hotpatch, wantBody)
+			}
+			if !reflect.DeepEqual(padding, tt.padding) {
+				t.Errorf("ResolveEntries() = %v, want %v", padding, tt.padding)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package utils
+
+import "sort"
+
+// SetInlineChains attaches to every instruction the chain of the subroutines
+// it is inlined from, outermost first
+func SetInlineChains(insts map[int]InsnSupplementary, inlines []InlineRow) {
+	insnLst := make([]int, 0, len(insts))
+	for offset := range insts {
+		insnLst = append(insnLst, offset)
+	}
+	sort.Ints(insnLst)
+	rows := make([]InlineRow, len(inlines))
+	copy(rows, inlines)
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Depth < rows[j].Depth
+	})
+	for _, in := range rows {
+		for i := sort.SearchInts(insnLst, in.Start); i < len(insnLst) && insnLst[i] < in.End; i++ {
+			supplementary := insts[insnLst[i]]
+			supplementary.InlineChain = append(supplementary.InlineChain, in.Callee)
+			insts[insnLst[i]] = supplementary
+		}
+	}
+}
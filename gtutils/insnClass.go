@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+
+	pstruct "github.com/pangine/pangineDSM-utils/program-struct"
+)
+
+// Normalized instruction classes stored in the "class" column of the insn table
+const (
+	ClassCall     = "call"
+	ClassJmp      = "jmp"
+	ClassJcc      = "jcc"
+	ClassRet      = "ret"
+	ClassIndirect = "indirect"
+	ClassNop      = "nop"
+	ClassOther    = "other"
+)
+
+// InstClass normalizes the flags of a resolved instruction into one class.
+// Indirect jumps and calls are all put into ClassIndirect, as they are the
+// ones that need to be evaluated separately.
+func InstClass(insnType pstruct.InstFlags) string {
+	switch {
+	case insnType.IsRet:
+		return ClassRet
+	case insnType.IsIndJmp || IsIndirectCall(insnType):
+		return ClassIndirect
+	case insnType.IsCall:
+		return ClassCall
+	case insnType.IsConditional:
+		return ClassJcc
+	case insnType.IsJmp:
+		return ClassJmp
+	case insnType.IsNop:
+		return ClassNop
+	}
+	return ClassOther
+}
+
+// IsIndirectCall returns true for calls through a register or memory operand.
+// Direct calls have an immediate target operand.
+func IsIndirectCall(insnType pstruct.InstFlags) bool {
+	if !insnType.IsCall {
+		return false
+	}
+	fields := strings.Fields(insnType.OriginInst)
+	for i, f := range fields {
+		if strings.HasPrefix(f, "call") && i+1 < len(fields) {
+			_, err := strconv.ParseInt(strings.TrimPrefix(fields[i+1], "$"), 0, 64)
+			return err != nil
+		}
+	}
+	return false
+}
+
+// InstMnemonic returns the mnemonic of a resolved instruction, together with
+// its prefixes (e.g. "rep stosq")
+func InstMnemonic(insnType pstruct.InstFlags) string {
+	prefixes := make(map[string]bool)
+	for _, p := range insnType.Prefixes {
+		prefixes[p] = true
+	}
+	fields := strings.Fields(insnType.OriginInst)
+	for i, f := range fields {
+		if !prefixes[f] {
+			return strings.Join(fields[:i+1], " ")
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// IsControlTransfer returns true if instructions in the class change the control flow
+func IsControlTransfer(class string) bool {
+	switch class {
+	case ClassCall, ClassJmp, ClassJcc, ClassRet, ClassIndirect:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"fmt"
+
+	pstruct "github.com/pangine/pangineDSM-utils/program-struct"
+)
+
+// LibraryFunc is a function read from a library object, used to label code
+// that has no listing, e.g. CRT startup code and statically linked libraries
+type LibraryFunc struct {
+	Name      string
+	Object    string
+	Code      []byte
+	Relocated []bool // Bytes modified by the linker, not compared
+	CodeSize  int    // Bytes before the data at the end of the function, e.g. a jump table
+}
+
+// LibraryIndex stores library functions by names
+type LibraryIndex map[string][]LibraryFunc
+
+// Add records a library function, functions without code are ignored
+func (lib LibraryIndex) Add(f LibraryFunc) {
+	if len(f.Code) == 0 {
+		return
+	}
+	if f.CodeSize <= 0 || f.CodeSize > len(f.Code) {
+		f.CodeSize = len(f.Code)
+	}
+	lib[f.Name] = append(lib[f.Name], f)
+}
+
+// TableStart returns the first of at least two consecutive pointers of size
+// bytes at the sorted offsets, -1 if there is none. Offsets are the pointer
+// relocations of a function that point back into its own section, and such a
+// run is a table of code addresses (e.g. a jump table) rather than operands.
+func TableStart(offsets []int, size int) int {
+	for i := 0; i+1 < len(offsets); i++ {
+		if offsets[i+1]-offsets[i] == size {
+			return offsets[i]
+		}
+	}
+	return -1
+}
+
+// MatchLibraryFuncs matches the code at function symbols with library
+// functions of the same names byte-for-byte modulo relocations. The code
+// ranges end before the data of the library functions.
+func MatchLibraryFuncs(lib LibraryIndex, symbols []SymbolFuncInfo, bi pstruct.BinaryInfo) (ranges []CodeRange) {
+	if len(lib) == 0 {
+		return
+	}
+	for _, s := range symbols {
+		if !pstruct.VAisValid(bi.ProgramHeaders, s.Offset) {
+			continue
+		}
+		phy := pstruct.V2PConv(bi.ProgramHeaders, s.Offset)
+		for _, f := range lib[s.Function] {
+			if phy < 0 || phy+len(f.Code) > len(bi.Sections.Data) {
+				continue
+			}
+			code := bi.Sections.Data[phy : phy+len(f.Code)]
+			matched := true
+			for i := range f.Code {
+				if !f.Relocated[i] && f.Code[i] != code[i] {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				fmt.Printf("\t%s > %s < %s (library)\n", s.Source, s.Function, f.Object)
+				ranges = append(ranges, CodeRange{
+					Name:  s.Function,
+					Start: s.Offset,
+					End:   s.Offset + f.CodeSize,
+				})
+				break
+			}
+		}
+	}
+	return
+}
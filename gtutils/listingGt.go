@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"strings"
 
 	genutils "github.com/pangine/pangineDSM-utils/general"
 	mcclient "github.com/pangine/pangineDSM-utils/mcclient"
@@ -15,7 +16,14 @@ type LstInsn struct {
 	Length  int  // Length of bytes used
 	IsAlign bool // Is an align
 	Label   string
-	Index   int // # of Insn under its label
+	Index   int      // # of Insn under its label
+	Refs    []string // Local labels referenced by the insn
+	Align   string   // The directive generating an align
+	File    string   // Source file of the insn, empty if unknown
+	Line    int      // Source line of the insn, 0 if unknown
+	Column  int      // Source column of the insn, 0 if unknown
+	LstLine int      // Line number of the insn in the LST
+	Cfi     []string // CFI directives since the previous insn
 }
 
 // LstLabel is a structure used to store label information in LSTs
@@ -24,12 +32,117 @@ type LstLabel struct {
 	Name   string
 }
 
+// LstJumpTable is a structure used to store jump tables referenced in LSTs
+type LstJumpTable struct {
+	Label     string
+	EntrySize int
+	Base      string   // Entries are relative to this label, empty for absolute entries
+	Entries   []string // Target labels
+}
+
+// GotSymbol is the LstJumpTable base of i386 PIC entries (.L3@GOTOFF)
+const GotSymbol = "_GLOBAL_OFFSET_TABLE_"
+
+// LstData is a structure used to store data pieces inside functions in LSTs
+type LstData struct {
+	Offset    int
+	Length    int
+	Directive string
+	Refs      []string // Labels referenced by the data
+}
+
 // LstFunc is a struction that collect all insns and labels in a funciton
 type LstFunc struct {
-	InsnAry  []LstInsn
-	LabelAry []LstLabel
-	FuncLen  int
-	Source   string
+	InsnAry    []LstInsn
+	LabelAry   []LstLabel
+	FuncLen    int
+	Source     string
+	JumpTables []LstJumpTable
+	DataAry    []LstData
+	TailAligns []LstInsn // Aligns after the last insn, removed from InsnAry
+	EntryAlign string    // The align directive right before the function
+}
+
+// AddData records a data piece in the function,
+// neighboring pieces of the same directive are considered as one
+func (f *LstFunc) AddData(offset, length int, directive string, refs []string) {
+	if n := len(f.DataAry); n > 0 &&
+		f.DataAry[n-1].Offset+f.DataAry[n-1].Length == offset &&
+		f.DataAry[n-1].Directive == directive {
+		f.DataAry[n-1].Length += length
+		f.DataAry[n-1].Refs = append(f.DataAry[n-1].Refs, refs...)
+		return
+	}
+	f.DataAry = append(f.DataAry, LstData{
+		Offset:    offset,
+		Length:    length,
+		Directive: directive,
+		Refs:      refs,
+	})
+}
+
+// LabelAddresses returns the virtual addresses of the labels (without ":")
+// in a function starting at virtual address funcStart
+func LabelAddresses(f *LstFunc, funcStart int, bi pstruct.BinaryInfo) (labelAddr map[string]int) {
+	headers := bi.ProgramHeaders
+	phyFuncStart := pstruct.V2PConv(headers, funcStart)
+	labelAddr = make(map[string]int)
+	for _, label := range f.LabelAry {
+		labelAddr[strings.TrimSuffix(label.Name, ":")] = pstruct.P2VConv(headers, phyFuncStart+label.Offset)
+	}
+	return
+}
+
+// ResolveDataRegions translates the data pieces of a matched function
+// into virtual addresses
+func ResolveDataRegions(f *LstFunc, funcStart int, bi pstruct.BinaryInfo) (regions []DataRegionRow) {
+	headers := bi.ProgramHeaders
+	phyFuncStart := pstruct.V2PConv(headers, funcStart)
+	labelAddr := LabelAddresses(f, funcStart, bi)
+	for _, d := range f.DataAry {
+		region := DataRegionRow{
+			FuncStart: funcStart,
+			Start:     pstruct.P2VConv(headers, phyFuncStart+d.Offset),
+			End:       pstruct.P2VConv(headers, phyFuncStart+d.Offset+d.Length),
+			Kind:      DataPlain,
+			Directive: d.Directive,
+			Targets:   make([]int, 0),
+		}
+		for _, ref := range d.Refs {
+			if addr, ok := labelAddr[ref]; ok {
+				region.Targets = append(region.Targets, addr)
+			}
+		}
+		if len(region.Targets) > 0 {
+			region.Kind = DataJumpTable
+		}
+		regions = append(regions, region)
+	}
+	return
+}
+
+// Origins of instructions stored in the "provenance" table
+const (
+	// OriginLst insns are matched with LST insns
+	OriginLst = "lst"
+	// OriginAlign insns are expanded from LST aligns
+	OriginAlign = "align"
+	// OriginAggressive insns are discovered by AggressiveRootSearch
+	OriginAggressive = "aggressive"
+	// OriginLinker insns are decoded from linker generated stubs
+	OriginLinker = "linker"
+	// OriginLibrary insns are decoded from code matched with library objects
+	OriginLibrary = "library"
+)
+
+// Provenance records where an instruction in the ground truth comes from
+type Provenance struct {
+	Origin      string
+	Lst         string
+	LstLine     int
+	Label       string
+	Index       int
+	Predecessor int // The insn leading to an aggressive discovered insn, -1 for others
 }
 
 // InsnRoot records a new root for recursive traversal algorithm to work on
@@ -110,11 +223,7 @@ func MatchForGroundTruth(
 				if !res.IsInst() || res.TakeBytes() == 0 {
 					return
 				}
-				supplementary := InsnSupplementary{}
-				if insn.IsAlign {
-					supplementary.Optional = true
-				}
-				insnOffsets[vInstPointer] = supplementary
+				pieceOffset := vInstPointer
 
 				insnLength = int(res.TakeBytes())
 				sizeSum += insnLength
@@ -128,6 +237,32 @@ func MatchForGroundTruth(
 					insnStr = "##INST"
 				}
 				insnType = obj.TypeInst(insnStr, insnLength)
+				supplementary := InsnSupplementary{
+					Mnemonic:     InstMnemonic(insnType),
+					Class:        InstClass(insnType),
+					IndirectCall: IsIndirectCall(insnType),
+					Edges:        InstEdges(insnType, vInstPointer),
+					Length:       insnLength,
+					File:         insn.File,
+					Line:         insn.Line,
+					Column:       insn.Column,
+					Provenance: Provenance{
+						Origin:      OriginLst,
+						Lst:         file,
+						LstLine:     insn.LstLine,
+						Label:       insn.Label,
+						Index:       insn.Index,
+						Predecessor: -1,
+					},
+				}
+				if insn.Index == 0 && pieceOffset == virtualOffset {
+					supplementary.LabelStart = true
+				}
+				if insn.IsAlign {
+					supplementary.Optional = true
+					supplementary.Provenance.Origin = OriginAlign
+				}
+				insnOffsets[pieceOffset] = supplementary
 				if insn.IsAlign && !insnType.IsNop {
 					// align instructions must be nops
 					return
@@ -218,13 +353,23 @@ func MatchForGroundTruth(
 }
 
 // AggressiveRootSearch do recursive traversal on input root to find new instrucitons
+// Instructions are never discovered in the input data regions
 func AggressiveRootSearch(
 	newRootsQue []InsnRoot,
 	instMap map[int]InsnSupplementary,
 	lowbound, upbound int,
+	dataRegions []DataRegionRow,
 	bi pstruct.BinaryInfo,
 	obj objectapi.Object,
 ) {
+	overlapData := func(start, end int) bool {
+		for _, d := range dataRegions {
+			if start < d.End && end > d.Start {
+				return true
+			}
+		}
+		return false
+	}
 	// Aggressively try to discover new instructions from new roots
 	// TODO: turn off
 	for len(newRootsQue) > 0 {
@@ -251,14 +396,29 @@ func AggressiveRootSearch(
 				if err != nil {
 					insnStr = "##INST"
 				}
-				// Aggressive generated instructions are all optional
-				supplementary := InsnSupplementary{Optional: true}
-				instMap[root.Offset] = supplementary
-				fmt.Printf("\t\tAggressive: %x: %s, precedessar: %x\n", root.Offset, insnStr, root.Predecessor)
 				insnLength := int(res.TakeBytes())
-				insnType := obj.TypeInst(insnStr, insnLength)
 				phyIP += insnLength
 				vrlIP := pstruct.P2VConv(bi.ProgramHeaders, phyIP)
+				if overlapData(root.Offset, vrlIP) {
+					fmt.Printf("\t\tAggressive: %x overlaps data, precedessar: %x\n", root.Offset, root.Predecessor)
+					continue
+				}
+				fmt.Printf("\t\tAggressive: %x: %s, precedessar: %x\n", root.Offset, insnStr, root.Predecessor)
+				insnType := obj.TypeInst(insnStr, insnLength)
+				// Aggressive generated instructions are all optional
+				supplementary := InsnSupplementary{
+					Optional:     true,
+					Mnemonic:     InstMnemonic(insnType),
+					Class:        InstClass(insnType),
+					IndirectCall: IsIndirectCall(insnType),
+					Edges:        InstEdges(insnType, vrlIP),
+					Length:       insnLength,
+					Provenance: Provenance{
+						Origin:      OriginAggressive,
+						Predecessor: root.Predecessor,
+					},
+				}
+				instMap[root.Offset] = supplementary
 				successors := genutils.InstSuccessors(insnType, vrlIP)
 				for _, s := range successors {
 					newRootsQue = append(newRootsQue,
@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// SchemaVersion is the version of the ground truth database layout. Version 1
+// databases have no meta table and any subset of the tables that came before
+// it, and version 2 databases have the meta table, the insn length and bytes,
+// and every other table.
+const SchemaVersion = 2
+
+// GeneratorVersion identifies the generator build, set with
+// -ldflags "-X github.com/pangine/disasm-gt-generator/gtutils.GeneratorVersion=<commit>"
+var GeneratorVersion = "unknown"
+
+// GtMeta stores how a ground truth database was generated, in the "meta" table
+type GtMeta struct {
+	Triple     string
+	BinaryHash string            // SHA-256 of the binary
+	Inputs     map[string]string // SHA-256 of the listings and objects by name
+	Options    map[string]string // Command line options
+	Timestamp  time.Time
+	// Tables that are not computed for the binary format, e.g. the
+	// symbolization of COFF binaries
+	Unsupported []string
+}
+
+// FileSHA256 returns the hex SHA-256 of a file, empty if it cannot be read
+func FileSHA256(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// InputHashes hashes the listing and object files matched by Lst2ObjMatch
+func InputHashes(asmDir, objDir string, aoMap map[string]string) (inputs map[string]string) {
+	inputs = make(map[string]string)
+	for lst, obj := range aoMap {
+		inputs[lst] = FileSHA256(filepath.Join(asmDir, lst))
+		inputs[obj] = FileSHA256(filepath.Join(objDir, obj))
+	}
+	return
+}
+
+// metaRows lists the key value pairs of the "meta" table
+func (m GtMeta) metaRows() (rows [][]interface{}) {
+	inputs, _ := json.Marshal(m.Inputs)
+	options, _ := json.Marshal(m.Options)
+	unsupported, _ := json.Marshal(append([]string{}, m.Unsupported...))
+	timestamp := ""
+	if !m.Timestamp.IsZero() {
+		timestamp = m.Timestamp.UTC().Format(time.RFC3339)
+	}
+	pairs := map[string]string{
+		"schema_version": strconv.Itoa(SchemaVersion),
+		"generator":      "disasm-gt-generator " + GeneratorVersion,
+		"triple":         m.Triple,
+		"binary_sha256":  m.BinaryHash,
+		"inputs":         string(inputs),
+		"options":        string(options),
+		"timestamp":      timestamp,
+		"unsupported":    string(unsupported),
+	}
+	keys := make([]string, 0, len(pairs))
+	for k := range pairs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		rows = append(rows, []interface{}{k, pairs[k]})
+	}
+	return
+}
+
+// readMeta reads the "meta" table as key value pairs, nil if there is none
+func readMeta(db *sql.DB) (meta map[string]string) {
+	rows, err := db.Query("SELECT key, value FROM meta")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	meta = make(map[string]string)
+	var key, value string
+	for rows.Next() {
+		rows.Scan(&key, &value)
+		meta[key] = value
+	}
+	return
+}
+
+// checkBinaryHash checks that the database was generated from binFile.
+// Databases without a hash only get a warning unless requireHash is set.
+func checkBinaryHash(db *sql.DB, sqlpath, binFile string, requireHash bool) (failed bool) {
+	meta := readMeta(db)
+	if meta == nil || meta["binary_sha256"] == "" {
+		if requireHash {
+			fmt.Printf("\tERROR: %s has no binary hash, it cannot be checked against %s\n", sqlpath, binFile)
+			failed = true
+			return
+		}
+		fmt.Printf("\tWARNING: %s has no binary hash, it cannot be checked against %s\n", sqlpath, binFile)
+		return
+	}
+	if hash := FileSHA256(binFile); hash != meta["binary_sha256"] {
+		fmt.Printf("\tERROR: %s is generated from a binary (sha256 %s) other than %s (sha256 %s)\n",
+			sqlpath, meta["binary_sha256"], binFile, hash)
+		failed = true
+	}
+	return
+}
@@ -0,0 +1,240 @@
+package utils
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	mcclient "github.com/pangine/pangineDSM-utils/mcclient"
+	objectapi "github.com/pangine/pangineDSM-utils/objectAPI"
+	pstruct "github.com/pangine/pangineDSM-utils/program-struct"
+)
+
+// derivedInsnColumns are the insn columns that migration decodes from the binary
+var derivedInsnColumns = map[string]bool{
+	"length":        true,
+	"bytes":         true,
+	"mnemonic":      true,
+	"class":         true,
+	"indirect_call": true,
+}
+
+// tableColumns returns the columns of an existing table, nil if there is none
+func tableColumns(db sqlRunner, table string) (columns map[string]bool) {
+	rows, err := db.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		fmt.Printf("FATAL: sqlite table_info of %s failed\n", table)
+		panic(err)
+	}
+	defer rows.Close()
+	var cid, notNull, pk int
+	var name, colType string
+	var dflt sql.NullString
+	for rows.Next() {
+		rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk)
+		if columns == nil {
+			columns = make(map[string]bool)
+		}
+		columns[name] = true
+	}
+	return
+}
+
+// execSQL runs a statement that returns no rows
+func execSQL(db sqlRunner, query string, args ...interface{}) {
+	if _, err := db.Exec(query, args...); err != nil {
+		fmt.Printf("FATAL: sqlite statement %s failed\n", query)
+		panic(err)
+	}
+}
+
+// MigrateSqliteGt upgrades the ground truth database "sqlpath" in place to
+// SchemaVersion. Missing tables and columns are added, the new insn columns
+// are decoded from the binary, and every other new value is left NULL and
+// listed as unknown in the meta table. It fails if the database is newer than
+// this generator or is generated from another binary.
+func MigrateSqliteGt(
+	sqlpath, binFile, triple string,
+	bi pstruct.BinaryInfo,
+	obj objectapi.Object,
+) (failed bool) {
+	db, err := sql.Open("sqlite3", sqlpath)
+	if err != nil {
+		fmt.Printf("FATAL: sqlite file %s open failed\n", sqlpath)
+		panic(err)
+	}
+	defer db.Close()
+
+	if tableColumns(db, "insn") == nil {
+		fmt.Printf("\tERROR: %s is not a ground truth database\n", sqlpath)
+		failed = true
+		return
+	}
+	version := 1
+	meta := readMeta(db)
+	if meta != nil {
+		if v, err := strconv.Atoi(meta["schema_version"]); err == nil {
+			version = v
+		}
+		if checkBinaryHash(db, sqlpath, binFile, false) {
+			failed = true
+			return
+		}
+	}
+	if version > SchemaVersion {
+		fmt.Printf("\tERROR: %s has schema version %d, newer than %d\n", sqlpath, version, SchemaVersion)
+		failed = true
+		return
+	}
+	if version == SchemaVersion {
+		fmt.Printf("\tINFO: %s is up to date\n", sqlpath)
+		return
+	}
+
+	// Migrate in one transaction, an interrupted migration leaves the
+	// database as it was
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Println("FATAL: sqlite transaction failed")
+		panic(err)
+	}
+	defer tx.Rollback()
+
+	// Add the missing tables and columns
+	unknown := make([]string, 0)
+	var addedInsn []string
+	for _, t := range gtTables {
+		existing := tableColumns(tx, t.name)
+		if existing == nil {
+			createTable(tx, t.name, strings.Join(t.columns, ", "))
+			if t.name != "meta" {
+				unknown = append(unknown, t.name)
+			}
+			continue
+		}
+		for _, column := range t.columns {
+			name := strings.Fields(column)[0]
+			if existing[name] {
+				continue
+			}
+			execSQL(tx, "ALTER TABLE "+t.name+" ADD COLUMN "+column)
+			if t.name == "insn" && derivedInsnColumns[name] {
+				addedInsn = append(addedInsn, name)
+				continue
+			}
+			unknown = append(unknown, t.name+"."+name)
+		}
+	}
+
+	// Decode the new insn columns from the binary
+	if len(addedInsn) > 0 {
+		fmt.Printf("\tINFO: decoding %s of %s\n", strings.Join(addedInsn, ", "), sqlpath)
+		rows, err := tx.Query("SELECT offset FROM insn")
+		if err != nil {
+			fmt.Println("FATAL: sqlite select from insn failed")
+			panic(err)
+		}
+		var offsets []int
+		var offset int
+		for rows.Next() {
+			rows.Scan(&offset)
+			offsets = append(offsets, offset)
+		}
+		rows.Close()
+
+		sets := make([]string, 0, len(addedInsn))
+		for _, name := range addedInsn {
+			sets = append(sets, name+" = ?")
+		}
+		stm, err := tx.Prepare("UPDATE insn SET " + strings.Join(sets, ", ") + " WHERE offset = ?")
+		if err != nil {
+			fmt.Println("FATAL: sqlite insn update statement error")
+			panic(err)
+		}
+		var undecoded int
+		for _, offset := range offsets {
+			phyIP := pstruct.V2PConv(bi.ProgramHeaders, offset)
+			if !pstruct.VAisValid(bi.ProgramHeaders, offset) || phyIP < 0 || phyIP >= len(bi.Sections.Data) {
+				undecoded++
+				continue
+			}
+			res := mcclient.SendResolve(phyIP, bi.Sections.Data)
+			if !res.IsInst() || res.TakeBytes() == 0 {
+				undecoded++
+				continue
+			}
+			insnStr, err := res.Inst()
+			if err != nil {
+				insnStr = "##INST"
+			}
+			insnLength := int(res.TakeBytes())
+			if phyIP+insnLength > len(bi.Sections.Data) {
+				undecoded++
+				continue
+			}
+			insnType := obj.TypeInst(insnStr, insnLength)
+			values := map[string]interface{}{
+				"length":        insnLength,
+				"bytes":         hex.EncodeToString(bi.Sections.Data[phyIP : phyIP+insnLength]),
+				"mnemonic":      InstMnemonic(insnType),
+				"class":         InstClass(insnType),
+				"indirect_call": IsIndirectCall(insnType),
+			}
+			args := make([]interface{}, 0, len(addedInsn)+1)
+			for _, name := range addedInsn {
+				args = append(args, values[name])
+			}
+			if _, err := stm.Exec(append(args, offset)...); err != nil {
+				fmt.Println("FATAL: sqlite insn update failed")
+				panic(err)
+			}
+		}
+		stm.Close()
+		if undecoded > 0 {
+			fmt.Printf("\tWARNING: %d instructions of %s cannot be decoded, their new columns are unknown\n", undecoded, sqlpath)
+		}
+	}
+
+	// Record the migration
+	if meta == nil {
+		meta = make(map[string]string)
+	}
+	if meta["inputs"] == "" {
+		unknown = append(unknown, "meta.inputs")
+	}
+	if meta["options"] == "" {
+		unknown = append(unknown, "meta.options")
+	}
+	if prev := meta["unknown"]; prev != "" {
+		var prevUnknown []string
+		json.Unmarshal([]byte(prev), &prevUnknown)
+		unknown = append(prevUnknown, unknown...)
+	}
+	unknownJSON, _ := json.Marshal(unknown)
+	updates := map[string]string{
+		"schema_version": strconv.Itoa(SchemaVersion),
+		"migrated_from":  strconv.Itoa(version),
+		"migrated_by":    "disasm-gt-generator " + GeneratorVersion,
+		"migrated_at":    time.Now().UTC().Format(time.RFC3339),
+		"unknown":        string(unknownJSON),
+	}
+	if meta["triple"] == "" {
+		updates["triple"] = triple
+	}
+	if meta["binary_sha256"] == "" {
+		updates["binary_sha256"] = FileSHA256(binFile)
+	}
+	for key, value := range updates {
+		execSQL(tx, "INSERT OR REPLACE INTO meta (key, value) VALUES (?, ?)", key, value)
+	}
+	if err := tx.Commit(); err != nil {
+		fmt.Println("FATAL: sqlite transaction commit failed")
+		panic(err)
+	}
+	fmt.Printf("\tINFO: %s migrated from schema version %d to %d\n", sqlpath, version, SchemaVersion)
+	return
+}
@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	pstruct "github.com/pangine/pangineDSM-utils/program-struct"
+)
+
+// writeV1Gt writes a ground truth database with the schema before the meta table
+func writeV1Gt(t *testing.T, sqlpath string) {
+	db, err := sql.Open("sqlite3", sqlpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, query := range []string{
+		"CREATE TABLE insn (offset INTEGER PRIMARY KEY, supplementary TEXT)",
+		"CREATE TABLE func (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, start INTEGER, end INTEGER)",
+		"CREATE TABLE func2insns (id INTEGER PRIMARY KEY AUTOINCREMENT, fid INTEGER, insn INTEGER)",
+		"INSERT INTO insn (offset, supplementary) VALUES (4096, '{\"Optional\":false}'), (4097, '{\"Optional\":true}')",
+		"INSERT INTO func (id, name, start, end) VALUES (1, 'main', 4096, 4098)",
+		"INSERT INTO func2insns (fid, insn) VALUES (1, 4096), (1, 4097)",
+	} {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMigrateSqliteGt(t *testing.T) {
+	dir := t.TempDir()
+	sqlpath := filepath.Join(dir, "bin.sqlite")
+	binFile := filepath.Join(dir, "bin")
+	if err := os.WriteFile(binFile, []byte("binary"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeV1Gt(t, sqlpath)
+
+	// The binary has no code, so the new insn columns cannot be decoded
+	if MigrateSqliteGt(sqlpath, binFile, "x86_64-pc-linux-gnu", pstruct.BinaryInfo{}, nil) {
+		t.Fatal("migration of a v1 database failed")
+	}
+
+	db, err := sql.Open("sqlite3", sqlpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	meta := readMeta(db)
+	wantMeta := map[string]string{
+		"schema_version": strconv.Itoa(SchemaVersion),
+		"migrated_from":  "1",
+		"triple":         "x86_64-pc-linux-gnu",
+		"binary_sha256":  FileSHA256(binFile),
+	}
+	for key, value := range wantMeta {
+		if meta[key] != value {
+			t.Errorf("meta %s = %q, want %q", key, meta[key], value)
+		}
+	}
+	var unknown []string
+	if err := json.Unmarshal([]byte(meta["unknown"]), &unknown); err != nil {
+		t.Fatalf("meta unknown %q: %v", meta["unknown"], err)
+	}
+	isUnknown := make(map[string]bool)
+	for _, u := range unknown {
+		isUnknown[u] = true
+	}
+	for _, u := range []string{"func.noreturn", "edge", "meta.inputs", "meta.options"} {
+		if !isUnknown[u] {
+			t.Errorf("%s is not listed as unknown in %v", u, unknown)
+		}
+	}
+	for _, u := range []string{"insn.length", "insn.class", "meta"} {
+		if isUnknown[u] {
+			t.Errorf("%s is listed as unknown in %v", u, unknown)
+		}
+	}
+	for _, table := range gtTables {
+		columns := tableColumns(db, table.name)
+		if columns == nil {
+			t.Errorf("table %s is not created", table.name)
+			continue
+		}
+		for _, column := range table.columns {
+			if name := strings.Fields(column)[0]; !columns[name] {
+				t.Errorf("column %s.%s is not created", table.name, name)
+			}
+		}
+	}
+	var rows int
+	db.QueryRow("SELECT COUNT(*) FROM insn WHERE length IS NULL").Scan(&rows)
+	if rows != 2 {
+		t.Errorf("%d undecoded instructions, want 2", rows)
+	}
+
+	// Migrating again is a no-op, a newer database is refused
+	if MigrateSqliteGt(sqlpath, binFile, "x86_64-pc-linux-gnu", pstruct.BinaryInfo{}, nil) {
+		t.Error("migration of an up to date database failed")
+	}
+	if _, err := db.Exec("UPDATE meta SET value = ? WHERE key = 'schema_version'", SchemaVersion+1); err != nil {
+		t.Fatal(err)
+	}
+	if !MigrateSqliteGt(sqlpath, binFile, "x86_64-pc-linux-gnu", pstruct.BinaryInfo{}, nil) {
+		t.Error("migration of a newer database succeeded")
+	}
+}
+
+func TestMigrateSqliteGtRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	sqlpath := filepath.Join(dir, "bin.sqlite")
+	binFile := filepath.Join(dir, "bin")
+	otherBin := filepath.Join(dir, "other")
+	if err := os.WriteFile(binFile, []byte("binary"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(otherBin, []byte("other binary"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeV1Gt(t, sqlpath)
+	if MigrateSqliteGt(sqlpath, binFile, "x86_64-pc-linux-gnu", pstruct.BinaryInfo{}, nil) {
+		t.Fatal("migration of a v1 database failed")
+	}
+
+	insns, funcs, failed := ReadSqliteGt(sqlpath, binFile, true)
+	if failed {
+		t.Fatal("migrated database cannot be read against its binary")
+	}
+	wantInsns := map[int]InsnSupplementary{
+		4096: {},
+		4097: {Optional: true},
+	}
+	if !reflect.DeepEqual(insns, wantInsns) {
+		t.Errorf("insns = %+v, want %+v", insns, wantInsns)
+	}
+	wantFuncs := map[FuncRow]bool{{Name: "main", Start: 4096, End: 4098}: true}
+	if !reflect.DeepEqual(funcs, wantFuncs) {
+		t.Errorf("funcs = %+v, want %+v", funcs, wantFuncs)
+	}
+	if _, _, failed := ReadSqliteGt(sqlpath, otherBin, false); !failed {
+		t.Error("migrated database is read against another binary")
+	}
+}
@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"sort"
+
+	mcclient "github.com/pangine/pangineDSM-utils/mcclient"
+	objectapi "github.com/pangine/pangineDSM-utils/objectAPI"
+	pstruct "github.com/pangine/pangineDSM-utils/program-struct"
+)
+
+// Kinds of padding stored in the "padding" table
+const (
+	PaddingNop   = "nop"
+	PaddingInt3  = "int3"
+	PaddingZero  = "zero"
+	PaddingOther = "other"
+)
+
+// Locations of padding stored in the "padding" table
+const (
+	// PaddingIntra are aligns between instructions of a function
+	PaddingIntra = "intra"
+	// PaddingTail are aligns after the last instruction of a function
+	PaddingTail = "tail"
+	// PaddingInter are gaps between two functions
+	PaddingInter = "inter"
+)
+
+// PaddingRow stores the information required to create the "padding" table
+type PaddingRow struct {
+	FuncStart int // Start of the function containing the padding, -1 for inter-function gaps
+	Start     int
+	End       int
+	Kind      string
+	Location  string
+	Directive string // The align directive generated the padding, empty if unknown
+}
+
+// ResolvePadding translates the aligns of a matched function into padding regions.
+// The padding kinds are decided later in FillPadding.
+func ResolvePadding(f *LstFunc, funcStart int, bi pstruct.BinaryInfo) (padding []PaddingRow) {
+	headers := bi.ProgramHeaders
+	phyFuncStart := pstruct.V2PConv(headers, funcStart)
+	addAlign := func(insn LstInsn, location string) {
+		padding = append(padding, PaddingRow{
+			FuncStart: funcStart,
+			Start:     pstruct.P2VConv(headers, phyFuncStart+insn.Offset),
+			End:       pstruct.P2VConv(headers, phyFuncStart+insn.Offset+insn.Length),
+			Location:  location,
+			Directive: insn.Align,
+		})
+	}
+	for _, insn := range f.InsnAry {
+		if insn.IsAlign {
+			addAlign(insn, PaddingIntra)
+		}
+	}
+	for _, insn := range f.TailAligns {
+		addAlign(insn, PaddingTail)
+	}
+	return
+}
+
+// FillPadding adds the gaps between ground truth functions to padding and
+// classifies all of them. Gaps are bounded by the sections of the binary and
+// by the function symbols that have no ground truth, and unsized symbols end
+// the gap search until the next function or section. The gap before the first
+// function of a section starts at the section start. entryAligns maps
+// function starts to the align directives right before the functions.
+func FillPadding(
+	padding []PaddingRow,
+	funcs map[FuncRow][]int,
+	symbols []SymbolFuncInfo,
+	entryAligns map[int]string,
+	bi pstruct.BinaryInfo,
+	obj objectapi.Object,
+) []PaddingRow {
+	headers := bi.ProgramHeaders
+	type span struct {
+		start, end int
+		open       bool // Unsized symbol, the end is unknown
+	}
+	spans := make([]span, 0, len(funcs)+len(symbols))
+	for f := range funcs {
+		spans = append(spans, span{start: f.Start, end: f.End})
+	}
+	for _, symbol := range symbols {
+		spans = append(spans, span{
+			start: symbol.Offset,
+			end:   symbol.Offset + symbol.Size,
+			open:  symbol.Size == 0,
+		})
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start < spans[j].start
+		}
+		return !spans[i].open && spans[j].open
+	})
+	// Entry padding belongs to the function after it
+	entryStart := make(map[int]int)
+	for _, p := range padding {
+		if p.Location != PaddingEntry {
+			continue
+		}
+		if start, ok := entryStart[p.FuncStart]; !ok || p.Start < start {
+			entryStart[p.FuncStart] = p.Start
+		}
+	}
+	// Section starts in the binary data, -1 for addresses before all sections
+	sectionStarts := append([]int{}, bi.Sections.Offset...)
+	sort.Ints(sectionStarts)
+	sectionOf := func(addr int) int {
+		phy := pstruct.V2PConv(headers, addr)
+		i := sort.Search(len(sectionStarts), func(i int) bool { return sectionStarts[i] > phy })
+		if i == 0 {
+			return -1
+		}
+		return sectionStarts[i-1]
+	}
+	var cursor int
+	var open bool
+	for i, s := range spans {
+		section := sectionOf(s.start)
+		if i == 0 || sectionOf(cursor) != section {
+			// The gap before the first function of a section starts at
+			// the section start
+			cursor, open = pstruct.P2VConv(headers, section), false
+		}
+		gapStart := cursor
+		gapEnd := s.start
+		if start, ok := entryStart[gapEnd]; ok && start < gapEnd {
+			gapEnd = start
+		}
+		if section >= 0 && !open && gapStart < gapEnd {
+			padding = append(padding, PaddingRow{
+				FuncStart: -1,
+				Start:     gapStart,
+				End:       gapEnd,
+				Location:  PaddingInter,
+				Directive: entryAligns[s.start],
+			})
+		}
+		if s.open {
+			if s.start >= cursor {
+				cursor, open = s.start, true
+			}
+		} else if s.end > cursor || open && s.end >= cursor {
+			cursor, open = s.end, false
+		}
+	}
+	for i := range padding {
+		padding[i].Kind = classifyPadding(padding[i].Start, padding[i].End, bi, obj)
+	}
+	return padding
+}
+
+// classifyPadding decides the kind of padding using its bytes
+func classifyPadding(start, end int, bi pstruct.BinaryInfo, obj objectapi.Object) string {
+	data := bi.Sections.Data
+	phyStart := pstruct.V2PConv(bi.ProgramHeaders, start)
+	phyEnd := phyStart + end - start
+	if phyStart < 0 || phyEnd > len(data) || phyStart >= phyEnd {
+		return PaddingOther
+	}
+	allBytes := func(b uint8) bool {
+		for _, d := range data[phyStart:phyEnd] {
+			if d != b {
+				return false
+			}
+		}
+		return true
+	}
+	if allBytes(0xcc) {
+		return PaddingInt3
+	}
+	if allBytes(0x00) {
+		return PaddingZero
+	}
+	for phyIP := phyStart; phyIP < phyEnd; {
+		res := mcclient.SendResolve(phyIP, data)
+		if !res.IsInst() || res.TakeBytes() == 0 {
+			return PaddingOther
+		}
+		insnStr, err := res.Inst()
+		if err != nil {
+			return PaddingOther
+		}
+		insnLength := int(res.TakeBytes())
+		if !obj.TypeInst(insnStr, insnLength).IsNop {
+			return PaddingOther
+		}
+		phyIP += insnLength
+		if phyIP > phyEnd {
+			// The last nop exceeds the padding
+			return PaddingOther
+		}
+	}
+	return PaddingNop
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	pstruct "github.com/pangine/pangineDSM-utils/program-struct"
+)
+
+// paddingBinary is 0x100 bytes of int3 with zeros at [0x30, 0x40)
+func paddingBinary() pstruct.BinaryInfo {
+	data := make([]uint8, 0x100)
+	for i := range data {
+		if i < 0x30 || i >= 0x40 {
+			data[i] = 0xcc
+		}
+	}
+	return pstruct.BinaryInfo{
+		Sections: pstruct.Sections{
+			Name:   []string{".text", ".data"},
+			Offset: []int{0, 0x80},
+			Data:   data,
+		},
+	}
+}
+
+func TestFillPadding(t *testing.T) {
+	funcs := map[FuncRow][]int{
+		{Name: "f0", Start: 0x00, End: 0x10}: nil,
+		{Name: "f1", Start: 0x20, End: 0x30}: nil,
+		{Name: "f2", Start: 0x40, End: 0x50}: nil,
+	}
+	inter := func(start, end int, kind, directive string) PaddingRow {
+		return PaddingRow{FuncStart: -1, Start: start, End: end, Kind: kind, Location: PaddingInter, Directive: directive}
+	}
+	tests := []struct {
+		name    string
+		padding []PaddingRow
+		symbols []SymbolFuncInfo
+		want    []PaddingRow
+	}{
+		{"between functions", nil, nil, []PaddingRow{
+			inter(0x10, 0x20, PaddingInt3, ".p2align 4"),
+			inter(0x30, 0x40, PaddingZero, ""),
+		}},
+		{"sized symbol", nil, []SymbolFuncInfo{{Function: "s", Offset: 0x14, Size: 4}}, []PaddingRow{
+			inter(0x10, 0x14, PaddingInt3, ""),
+			inter(0x18, 0x20, PaddingInt3, ".p2align 4"),
+			inter(0x30, 0x40, PaddingZero, ""),
+		}},
+		{"unsized symbol", nil, []SymbolFuncInfo{{Function: "s", Offset: 0x18}}, []PaddingRow{
+			inter(0x10, 0x18, PaddingInt3, ""),
+			inter(0x30, 0x40, PaddingZero, ""),
+		}},
+		{"entry padding", []PaddingRow{{FuncStart: 0x20, Start: 0x1a, End: 0x20, Location: PaddingEntry}}, nil, []PaddingRow{
+			{FuncStart: 0x20, Start: 0x1a, End: 0x20, Kind: PaddingInt3, Location: PaddingEntry},
+			inter(0x10, 0x1a, PaddingInt3, ".p2align 4"),
+			inter(0x30, 0x40, PaddingZero, ""),
+		}},
+		{"intra padding", []PaddingRow{{FuncStart: 0x40, Start: 0x44, End: 0x48, Location: PaddingIntra}}, nil, []PaddingRow{
+			{FuncStart: 0x40, Start: 0x44, End: 0x48, Kind: PaddingInt3, Location: PaddingIntra},
+			inter(0x10, 0x20, PaddingInt3, ".p2align 4"),
+			inter(0x30, 0x40, PaddingZero, ""),
+		}},
+	}
+	entryAligns := map[int]string{0x20: ".p2align 4"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FillPadding(tt.padding, funcs, tt.symbols, entryAligns, paddingBinary(), nil)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FillPadding() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFillPaddingSections(t *testing.T) {
+	funcs := map[FuncRow][]int{
+		{Name: "f0", Start: 0x08, End: 0x10}: nil,
+		{Name: "f1", Start: 0x20, End: 0x70}: nil,
+		{Name: "f2", Start: 0x88, End: 0x90}: nil,
+	}
+	inter := func(start, end int, kind string) PaddingRow {
+		return PaddingRow{FuncStart: -1, Start: start, End: end, Kind: kind, Location: PaddingInter}
+	}
+	tests := []struct {
+		name    string
+		symbols []SymbolFuncInfo
+		want    []PaddingRow
+	}{
+		{"section bounds", nil, []PaddingRow{
+			inter(0x00, 0x08, PaddingInt3),
+			inter(0x10, 0x20, PaddingInt3),
+			inter(0x80, 0x88, PaddingInt3),
+		}},
+		{"unsized symbol before a section", []SymbolFuncInfo{{Function: "s", Offset: 0x70}}, []PaddingRow{
+			inter(0x00, 0x08, PaddingInt3),
+			inter(0x10, 0x20, PaddingInt3),
+			inter(0x80, 0x88, PaddingInt3),
+		}},
+		{"symbol at a section start", []SymbolFuncInfo{{Function: "s", Offset: 0x80, Size: 4}}, []PaddingRow{
+			inter(0x00, 0x08, PaddingInt3),
+			inter(0x10, 0x20, PaddingInt3),
+			inter(0x84, 0x88, PaddingInt3),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FillPadding(nil, funcs, tt.symbols, nil, paddingBinary(), nil)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FillPadding() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyPadding(t *testing.T) {
+	bi := paddingBinary()
+	tests := []struct {
+		name       string
+		start, end int
+		kind       string
+	}{
+		{"int3", 0x00, 0x30, PaddingInt3},
+		{"zero", 0x30, 0x40, PaddingZero},
+		{"empty", 0x30, 0x30, PaddingOther},
+		{"out of binary", 0xf8, 0x108, PaddingOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if kind := classifyPadding(tt.start, tt.end, bi, nil); kind != tt.kind {
+				t.Errorf("classifyPadding() = %s, want %s", kind, tt.kind)
+			}
+		})
+	}
+}
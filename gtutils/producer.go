@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// optLevelPattern matches GNU (-O2) and MSVC (/O2) optimization flags
+var optLevelPattern = regexp.MustCompile(`^[-/](O(?:[0-3sgdxz]|fast)?)$`)
+
+// OptLevel returns the last optimization flag in a producer string or a
+// compiler command line, empty if there is none
+func OptLevel(flags string) (level string) {
+	for _, field := range strings.Fields(flags) {
+		if m := optLevelPattern.FindStringSubmatch(field); m != nil {
+			level = m[1]
+		}
+	}
+	return
+}
+
+// SetFuncProducers records the producers of functions, keyed by function
+// starts, in their attributes
+func SetFuncProducers(attrs map[int]FuncAttr, producers map[int]string) {
+	for start, producer := range producers {
+		attr := attrs[start]
+		attr.Producer = producer
+		if attr.OptLevel == "" {
+			attr.OptLevel = OptLevel(producer)
+		}
+		attrs[start] = attr
+	}
+}
+
+// CountProducers summarizes the producers from one source into metadata rows
+func CountProducers(source string, producers []string) (rows []MetadataRow) {
+	counts := make(map[string]int)
+	for _, p := range producers {
+		counts[p]++
+	}
+	for p, count := range counts {
+		rows = append(rows, MetadataRow{
+			Source:   source,
+			Producer: p,
+			OptLevel: OptLevel(p),
+			Count:    count,
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Producer < rows[j].Producer
+	})
+	return
+}
@@ -0,0 +1,35 @@
+package utils
+
+import "fmt"
+
+// DWARF base type encodings
+const (
+	dwAteAddress      = 0x1
+	dwAteBoolean      = 0x2
+	dwAteComplexFloat = 0x3
+	dwAteFloat        = 0x4
+	dwAteSigned       = 0x5
+	dwAteSignedChar   = 0x6
+	dwAteUnsigned     = 0x7
+	dwAteUnsignedChar = 0x8
+	dwAteUTF          = 0x10
+)
+
+// NormalizeBaseType names a base type by its DWARF encoding and byte size,
+// e.g. "int32", "uint8", "float64" and "bool"
+func NormalizeBaseType(encoding, size int) string {
+	bits := size * 8
+	switch encoding {
+	case dwAteBoolean:
+		return "bool"
+	case dwAteFloat:
+		return fmt.Sprintf("float%d", bits)
+	case dwAteComplexFloat:
+		return fmt.Sprintf("complex%d", bits)
+	case dwAteSigned, dwAteSignedChar:
+		return fmt.Sprintf("int%d", bits)
+	case dwAteUnsigned, dwAteUnsignedChar, dwAteUTF, dwAteAddress:
+		return fmt.Sprintf("uint%d", bits)
+	}
+	return "unspecified"
+}
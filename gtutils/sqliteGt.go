@@ -2,6 +2,7 @@ package utils
 
 import (
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -11,11 +12,92 @@ import (
 
 	// For sqlite3 sql plugin init
 	_ "github.com/mattn/go-sqlite3"
+	pstruct "github.com/pangine/pangineDSM-utils/program-struct"
 )
 
 // InsnSupplementary are sparse information for instructions
+// Fields tagged with "-" are not sparse, they are stored in their own columns
 type InsnSupplementary struct {
-	Optional bool
+	Optional     bool
+	Mnemonic     string     `json:"-"`
+	Class        string     `json:"-"`
+	IndirectCall bool       `json:"-"` // ClassIndirect instruction that is a call
+	Edges        []InsnEdge `json:"-"`
+	Length       int        `json:"-"`
+	LabelStart   bool       `json:"-"` // First instruction under an LST label
+	File         string     `json:"-"`
+	Line         int        `json:"-"`
+	Column       int        `json:"-"`
+	Provenance   Provenance `json:"-"`
+	TailCall     bool       `json:"-"` // Direct jmp to the start of another function
+	NoReturnCall bool       `json:"-"` // Call to a function that never returns
+	LandingPad   bool       `json:"-"` // Exception handler reached by unwinding
+	InlineChain  []string   `json:"-"` // Functions inlined here, outermost first
+	Cfa          *CfaState  `json:"-"` // Call frame information, nil if unknown
+}
+
+// MergeInsnSupplementary merges the supplementary of an instruction that is
+// recorded by more than one function. Flags and edges are merged from both
+// records, other fields are taken from the preferred record and filled from
+// the other one if unknown. The result does not depend on the argument order.
+func MergeInsnSupplementary(old, new InsnSupplementary) (merged InsnSupplementary) {
+	if insnPrecedes(new, old) {
+		old, new = new, old
+	}
+	merged = old
+	merged.Optional = old.Optional && new.Optional
+	merged.LabelStart = old.LabelStart || new.LabelStart
+	merged.TailCall = old.TailCall || new.TailCall
+	merged.NoReturnCall = old.NoReturnCall || new.NoReturnCall
+	merged.LandingPad = old.LandingPad || new.LandingPad
+	merged.Edges = mergeEdges(old.Edges, new.Edges)
+	if merged.Length == 0 {
+		merged.Length = new.Length
+	}
+	if merged.File == "" {
+		merged.File, merged.Line, merged.Column = new.File, new.Line, new.Column
+	}
+	if len(merged.InlineChain) == 0 {
+		merged.InlineChain = new.InlineChain
+	}
+	if merged.Cfa == nil {
+		merged.Cfa = new.Cfa
+	}
+	return
+}
+
+// insnPrecedes returns true if record a is preferred over record b when
+// merging: non-optional records first, then by listing location
+func insnPrecedes(a, b InsnSupplementary) bool {
+	if a.Optional != b.Optional {
+		return !a.Optional
+	}
+	pa, pb := a.Provenance, b.Provenance
+	if pa.Lst != pb.Lst {
+		return pa.Lst < pb.Lst
+	}
+	if pa.LstLine != pb.LstLine {
+		return pa.LstLine < pb.LstLine
+	}
+	return pa.Index < pb.Index
+}
+
+// mergeEdges returns the union of two edge lists sorted by destination and kind
+func mergeEdges(a, b []InsnEdge) (edges []InsnEdge) {
+	seen := make(map[InsnEdge]bool)
+	for _, e := range append(append([]InsnEdge{}, a...), b...) {
+		if !seen[e] {
+			seen[e] = true
+			edges = append(edges, e)
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].Dst != edges[j].Dst {
+			return edges[i].Dst < edges[j].Dst
+		}
+		return edges[i].Kind < edges[j].Kind
+	})
+	return
 }
 
 // FuncRow stores the information required to create the "func" table
@@ -25,13 +107,307 @@ type FuncRow struct {
 	End   int
 }
 
+// JumpTableRow stores the information required to create the "jump_table" table
+type JumpTableRow struct {
+	FuncStart int // Start of the function owning the table
+	Address   int
+	EntrySize int
+	Base      int // Entries are relative to Base, 0 for absolute entries
+	Entries   []int
+	Targets   []int
+	Owner     int // The indirect jump using this table, -1 if not found
+}
+
+// Kinds of data regions stored in the "data_region" table
+const (
+	// DataPlain regions are constants or unknown data
+	DataPlain = "data"
+	// DataJumpTable regions reference labels in the function
+	DataJumpTable = "jump-table"
+)
+
+// DataRegionRow stores the information required to create the "data_region" table
+type DataRegionRow struct {
+	FuncStart int // Start of the function containing the data
+	Start     int
+	End       int
+	Kind      string
+	Directive string
+	Targets   []int
+}
+
+// AddressTakenRow stores the information required to create the "address_taken" table
+type AddressTakenRow struct {
+	Location   int // Where the function pointer is stored
+	Size       int
+	Section    string
+	Target     int
+	TargetName string
+}
+
+// SymbolizationRow stores the information required to create the "symbolization" table
+type SymbolizationRow struct {
+	Insn          int
+	OperandOffset int // Byte offset of the relocated field in the instruction
+	Size          int
+	Symbol        string
+	Addend        int
+	Target        int // Address of the symbol in the binary, -1 if unknown
+	Type          string
+}
+
+// FuncAliasRow stores the information required to create the "func_alias" table
+type FuncAliasRow struct {
+	FuncStart int // Start of the function body the symbol is folded into
+	Name      string
+}
+
+// MetadataRow stores the information required to create the "metadata" table
+type MetadataRow struct {
+	Source   string // Where the producer is recorded, e.g. "dwarf", "comment", "rich"
+	Producer string
+	OptLevel string
+	Count    int // Number of compile units or objects with this producer
+}
+
+// InlineRow stores the information required to create the "inline" table
+type InlineRow struct {
+	FuncStart  int // Start of the function the range is inlined into
+	Start      int
+	End        int
+	Callee     string
+	CallFile   string
+	CallLine   int
+	CallColumn int
+	Depth      int // 1 for subroutines inlined directly into the function
+}
+
+// TypeRef is a normalized type, e.g. {"int32", 1} for int*
+type TypeRef struct {
+	Base    string `json:"type"`
+	Pointer int    `json:"pointer"` // Pointer depth
+}
+
+// PrototypeRow stores the information required to create the "prototype" table
+type PrototypeRow struct {
+	FuncStart         int
+	Params            []TypeRef
+	Return            TypeRef
+	Variadic          bool
+	CallingConvention string
+}
+
+// DataObjectRow stores the information required to create the "data_object" table
+type DataObjectRow struct {
+	Name    string
+	Start   int
+	Size    int
+	Section string
+	Type    *TypeRef // nil without debug information
+}
+
+// GtExtra stores the ground truth that is not recorded per instruction
+type GtExtra struct {
+	JumpTables    []JumpTableRow
+	DataRegions   []DataRegionRow
+	Padding       []PaddingRow
+	AddressTaken  []AddressTakenRow // ELF only
+	Symbolization []SymbolizationRow
+	FuncAttrs     map[int]FuncAttr // Keyed by function start
+	FuncAliases   []FuncAliasRow
+	Metadata      []MetadataRow
+	Inlines       []InlineRow
+	Prototypes    []PrototypeRow
+	DataObjects   []DataObjectRow
+	Meta          GtMeta
+}
+
 type funcToInsn struct {
 	funcRow FuncRow
 	insns   []int
 }
 
-// CreateSqliteGt creates an sqlite file "sqlpath" with input insn and func data
-func CreateSqliteGt(sqlpath string, insns map[int]InsnSupplementary, funcs map[FuncRow][]int) {
+// gtTable is the layout of a ground truth table
+type gtTable struct {
+	name    string
+	columns []string
+}
+
+// gtTables are the tables of a ground truth database, in creation order
+var gtTables = []gtTable{
+	{"meta", []string{
+		"key TEXT PRIMARY KEY",
+		"value TEXT",
+	}},
+	{"insn", []string{
+		"offset INTEGER PRIMARY KEY",
+		"supplementary TEXT",
+		"length INTEGER",
+		"bytes TEXT",
+		"mnemonic TEXT",
+		"class TEXT",
+		"indirect_call INTEGER",
+		"tail_call INTEGER",
+		"noreturn_call INTEGER",
+		"landing_pad INTEGER",
+		"inline_chain TEXT",
+	}},
+	{"func", []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT",
+		"name TEXT",
+		"start INTEGER",
+		"end INTEGER",
+		"noreturn INTEGER",
+		"tail_call INTEGER",
+		"funclet TEXT",
+		"parent INTEGER",
+		"producer TEXT",
+		"opt_level TEXT",
+		"endbr INTEGER",
+		"patchable_entry INTEGER",
+		"fentry INTEGER",
+		"hotpatch INTEGER",
+		"body_start INTEGER",
+	}},
+	{"metadata", []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT",
+		"source TEXT",
+		"producer TEXT",
+		"opt_level TEXT",
+		"count INTEGER",
+	}},
+	{"inline", []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT",
+		"fid INTEGER",
+		"start INTEGER",
+		"end INTEGER",
+		"callee TEXT",
+		"call_file TEXT",
+		"call_line INTEGER",
+		"call_column INTEGER",
+		"depth INTEGER",
+	}},
+	{"prototype", []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT",
+		"fid INTEGER",
+		"param_count INTEGER",
+		"params TEXT",
+		"return_type TEXT",
+		"return_pointer INTEGER",
+		"variadic INTEGER",
+		"calling_convention TEXT",
+	}},
+	{"data_object", []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT",
+		"name TEXT",
+		"offset INTEGER",
+		"size INTEGER",
+		"section TEXT",
+		"type TEXT",
+		"pointer INTEGER",
+	}},
+	{"func_alias", []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT",
+		"fid INTEGER",
+		"name TEXT",
+	}},
+	{"func2insns", []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT",
+		"fid INTEGER",
+		"insn INTEGER",
+	}},
+	{"edge", []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT",
+		"src INTEGER",
+		"dst INTEGER",
+		"kind TEXT",
+	}},
+	{"line", []string{
+		"offset INTEGER PRIMARY KEY",
+		"file TEXT",
+		"line INTEGER",
+		"column INTEGER",
+	}},
+	{"provenance", []string{
+		"offset INTEGER PRIMARY KEY",
+		"origin TEXT",
+		"lst TEXT",
+		"lst_line INTEGER",
+		"label TEXT",
+		"label_index INTEGER",
+		"predecessor INTEGER",
+	}},
+	{"cfi", []string{
+		"offset INTEGER PRIMARY KEY",
+		"cfa_register TEXT",
+		"cfa_offset INTEGER",
+		"saved_regs TEXT",
+	}},
+	{"basic_block", []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT",
+		"fid INTEGER",
+		"start INTEGER",
+		"end INTEGER",
+		"insn_count INTEGER",
+		"origin TEXT",
+	}},
+	{"jump_table", []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT",
+		"fid INTEGER",
+		"address INTEGER",
+		"entry_size INTEGER",
+		"base INTEGER",
+		"entries TEXT",
+		"targets TEXT",
+		"owner INTEGER",
+	}},
+	{"data_region", []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT",
+		"fid INTEGER",
+		"start INTEGER",
+		"end INTEGER",
+		"kind TEXT",
+		"directive TEXT",
+		"targets TEXT",
+	}},
+	{"padding", []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT",
+		"fid INTEGER",
+		"start INTEGER",
+		"end INTEGER",
+		"kind TEXT",
+		"location TEXT",
+		"directive TEXT",
+	}},
+	{"address_taken", []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT",
+		"location INTEGER",
+		"size INTEGER",
+		"section TEXT",
+		"target INTEGER",
+		"target_name TEXT",
+		"fid INTEGER",
+	}},
+	{"symbolization", []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT",
+		"insn INTEGER",
+		"operand_offset INTEGER",
+		"size INTEGER",
+		"symbol TEXT",
+		"addend INTEGER",
+		"target INTEGER",
+		"type TEXT",
+	}},
+}
+
+// CreateSqliteGt creates an sqlite file "sqlpath" with input insn, func and extra data
+func CreateSqliteGt(
+	sqlpath string,
+	insns map[int]InsnSupplementary,
+	funcs map[FuncRow][]int,
+	extra GtExtra,
+	bi pstruct.BinaryInfo,
+) {
 	os.Remove(sqlpath)
 	db, err := sql.Open("sqlite3", sqlpath)
 	if err != nil {
@@ -41,85 +417,81 @@ func CreateSqliteGt(sqlpath string, insns map[int]InsnSupplementary, funcs map[F
 	defer db.Close()
 
 	// create tables
-	stm, err := db.Prepare("CREATE TABLE IF NOT EXISTS insn (" +
-		"offset INTEGER PRIMARY KEY, " +
-		"supplementary TEXT" +
-		")")
-	if err != nil {
-		fmt.Println("FATAL: sqlite statement error")
-		panic(err)
+	for _, t := range gtTables {
+		createTable(db, t.name, strings.Join(t.columns, ", "))
 	}
-	stm.Exec()
-	stm.Close()
-	stm, err = db.Prepare("CREATE TABLE IF NOT EXISTS func (" +
-		"id INTEGER PRIMARY KEY AUTOINCREMENT, " +
-		"name TEXT, " +
-		"start INTEGER, " +
-		"end INTEGER" +
-		")")
-	if err != nil {
-		fmt.Println("FATAL: sqlite statement error")
-		panic(err)
-	}
-	stm.Exec()
-	stm.Close()
-	stm, err = db.Prepare("CREATE TABLE IF NOT EXISTS func2insns (" +
-		"id INTEGER PRIMARY KEY AUTOINCREMENT, " +
-		"fid INTEGER, " +
-		"insn INTEGER" +
-		")")
-	if err != nil {
-		fmt.Println("FATAL: sqlite statement error")
-		panic(err)
+
+	insnOffsets := make([]int, 0, len(insns))
+	for offset := range insns {
+		insnOffsets = append(insnOffsets, offset)
 	}
-	stm.Exec()
-	stm.Close()
+	sort.Ints(insnOffsets)
+
+	// generation metadata
+	insertRows(db, "meta", []string{"key", "value"}, extra.Meta.metaRows())
 
 	// instructions
-	const maxSQLVals = 100
-	insertStr := "INSERT INTO insn (offset, supplementary) VALUES "
-	value := "(?, ?)"
-	insertFormation := make([]string, 0)
-	vals := make([]interface{}, 0)
-	counter := 0
-	for offset, supplementary := range insns {
-		if counter++; counter >= maxSQLVals {
-			// sqlite3 plugin cannot support too many vals insertion at once
-			counter = 0
-			insertQuey := insertStr + strings.Join(insertFormation, ",")
-			stm, err = db.Prepare(insertQuey)
-			if err != nil {
-				fmt.Println("FATAL: sqlite insn statement error")
-				panic(err)
-			}
-			_, err = stm.Exec(vals...)
-			stm.Close()
-			if err != nil {
-				fmt.Println("FATAL: sqlite insn value insert error")
-				panic(err)
-			}
-			insertFormation = make([]string, 0)
-			vals = make([]interface{}, 0)
-		}
-		insertFormation = append(insertFormation, value)
+	rows := make([][]interface{}, 0, len(insns))
+	for _, offset := range insnOffsets {
+		supplementary := insns[offset]
 		jsonStr := insnSupplementaryToJSON(supplementary)
-		vals = append(vals, offset, jsonStr)
+		var inlineChain string
+		if len(supplementary.InlineChain) > 0 {
+			chain, _ := json.Marshal(supplementary.InlineChain)
+			inlineChain = string(chain)
+		}
+		rows = append(rows, []interface{}{offset, jsonStr,
+			supplementary.Length, insnBytes(bi, offset, supplementary.Length),
+			supplementary.Mnemonic, supplementary.Class, supplementary.IndirectCall,
+			supplementary.TailCall, supplementary.NoReturnCall, supplementary.LandingPad,
+			inlineChain})
+	}
+	insertRows(db, "insn",
+		[]string{"offset", "supplementary", "length", "bytes", "mnemonic", "class",
+			"indirect_call", "tail_call", "noreturn_call", "landing_pad", "inline_chain"}, rows)
 
+	// edges
+	rows = make([][]interface{}, 0)
+	for _, offset := range insnOffsets {
+		for _, e := range insns[offset].Edges {
+			rows = append(rows, []interface{}{offset, e.Dst, e.Kind})
+		}
 	}
-	insertStr += strings.Join(insertFormation, ",")
-	if len(vals) > 0 {
-		stm, err = db.Prepare(insertStr)
-		if err != nil {
-			fmt.Println("FATAL: sqlite insn statement error")
-			panic(err)
+	insertRows(db, "edge", []string{"src", "dst", "kind"}, rows)
+
+	// source lines
+	rows = make([][]interface{}, 0)
+	for _, offset := range insnOffsets {
+		supplementary := insns[offset]
+		if supplementary.Line == 0 {
+			continue
 		}
-		_, err = stm.Exec(vals...)
-		stm.Close()
-		if err != nil {
-			fmt.Println("FATAL: sqlite insn value insert error")
-			panic(err)
+		rows = append(rows, []interface{}{offset, supplementary.File,
+			supplementary.Line, supplementary.Column})
+	}
+	insertRows(db, "line", []string{"offset", "file", "line", "column"}, rows)
+
+	// provenance
+	rows = make([][]interface{}, 0, len(insns))
+	for _, offset := range insnOffsets {
+		p := insns[offset].Provenance
+		rows = append(rows, []interface{}{offset, p.Origin, p.Lst,
+			p.LstLine, p.Label, p.Index, p.Predecessor})
+	}
+	insertRows(db, "provenance",
+		[]string{"offset", "origin", "lst", "lst_line", "label", "label_index", "predecessor"}, rows)
+
+	// call frame information
+	rows = make([][]interface{}, 0)
+	for _, offset := range insnOffsets {
+		cfa := insns[offset].Cfa
+		if cfa == nil {
+			continue
 		}
+		saved, _ := json.Marshal(cfa.Saved)
+		rows = append(rows, []interface{}{offset, cfa.Register, cfa.Offset, string(saved)})
 	}
+	insertRows(db, "cfi", []string{"offset", "cfa_register", "cfa_offset", "saved_regs"}, rows)
 
 	funcLst := make([]funcToInsn, 0)
 	for funcRow, insns := range funcs {
@@ -133,99 +505,217 @@ func CreateSqliteGt(sqlpath string, insns map[int]InsnSupplementary, funcs map[F
 		return funcLst[i].funcRow.Start < funcLst[j].funcRow.Start
 	})
 
+	fidByStart := make(map[int]int)
+	for i, f := range funcLst {
+		fidByStart[f.funcRow.Start] = i
+	}
+	fidOf := func(start int) int {
+		if fid, ok := fidByStart[start]; ok {
+			return fid
+		}
+		return -1
+	}
+
 	// functions
-	insertStr = "INSERT INTO func (id, name, start, end) VALUES "
-	value = "(?, ?, ?, ?)"
-	insertFormation = make([]string, 0)
-	vals = make([]interface{}, 0)
-	counter = 0
+	rows = make([][]interface{}, 0, len(funcLst))
 	for i, f := range funcLst {
 		fr := f.funcRow
-		if counter++; counter >= maxSQLVals {
-			// sqlite3 plugin cannot support too many vals insertion at once
-			counter = 0
-			insertQuey := insertStr + strings.Join(insertFormation, ",")
-			stm, err = db.Prepare(insertQuey)
-			if err != nil {
-				fmt.Println("FATAL: sqlite func statement error")
-				panic(err)
-			}
-			_, err = stm.Exec(vals...)
-			stm.Close()
-			if err != nil {
-				fmt.Println("FATAL: sqlite func value insert error")
-				panic(err)
-			}
-			insertFormation = make([]string, 0)
-			vals = make([]interface{}, 0)
+		attr := extra.FuncAttrs[fr.Start]
+		parent := -1
+		if attr.Funclet.Kind != "" {
+			parent = fidOf(attr.Funclet.Parent)
 		}
-		insertFormation = append(insertFormation, value)
-		vals = append(vals, i, fr.Name, fr.Start, fr.End)
-	}
-	insertStr += strings.Join(insertFormation, ",")
-	if len(vals) > 0 {
-		stm, err = db.Prepare(insertStr)
-		if err != nil {
-			fmt.Println("FATAL: sqlite func statement error")
-			panic(err)
+		bodyStart := attr.BodyStart
+		if bodyStart == 0 {
+			bodyStart = fr.Start
 		}
-		_, err = stm.Exec(vals...)
-		if err != nil {
-			fmt.Println("FATAL: sqlite func value insert error")
-			panic(err)
+		rows = append(rows, []interface{}{i, fr.Name, fr.Start, fr.End,
+			attr.NoReturn, attr.TailCall, attr.Funclet.Kind, parent,
+			attr.Producer, attr.OptLevel, attr.Endbr, attr.PatchableEntry,
+			attr.Fentry, attr.Hotpatch, bodyStart})
+	}
+	insertRows(db, "func",
+		[]string{"id", "name", "start", "end", "noreturn", "tail_call",
+			"funclet", "parent", "producer", "opt_level", "endbr",
+			"patchable_entry", "fentry", "hotpatch", "body_start"}, rows)
+
+	// binary metadata
+	rows = make([][]interface{}, 0, len(extra.Metadata))
+	for _, m := range extra.Metadata {
+		rows = append(rows, []interface{}{m.Source, m.Producer, m.OptLevel, m.Count})
+	}
+	insertRows(db, "metadata", []string{"source", "producer", "opt_level", "count"}, rows)
+
+	// inlined subroutines
+	rows = make([][]interface{}, 0, len(extra.Inlines))
+	for _, in := range extra.Inlines {
+		rows = append(rows, []interface{}{fidOf(in.FuncStart), in.Start, in.End,
+			in.Callee, in.CallFile, in.CallLine, in.CallColumn, in.Depth})
+	}
+	insertRows(db, "inline", []string{"fid", "start", "end", "callee",
+		"call_file", "call_line", "call_column", "depth"}, rows)
+
+	// function prototypes
+	rows = make([][]interface{}, 0, len(extra.Prototypes))
+	for _, p := range extra.Prototypes {
+		params, _ := json.Marshal(p.Params)
+		rows = append(rows, []interface{}{fidOf(p.FuncStart), len(p.Params), string(params),
+			p.Return.Base, p.Return.Pointer, p.Variadic, p.CallingConvention})
+	}
+	insertRows(db, "prototype", []string{"fid", "param_count", "params", "return_type",
+		"return_pointer", "variadic", "calling_convention"}, rows)
+
+	// data objects
+	rows = make([][]interface{}, 0, len(extra.DataObjects))
+	for _, d := range extra.DataObjects {
+		var typeName, pointer interface{}
+		if d.Type != nil {
+			typeName, pointer = d.Type.Base, d.Type.Pointer
 		}
-		stm.Close()
+		rows = append(rows, []interface{}{d.Name, d.Start, d.Size, d.Section, typeName, pointer})
+	}
+	insertRows(db, "data_object", []string{"name", "offset", "size", "section", "type", "pointer"}, rows)
+
+	// function aliases
+	rows = make([][]interface{}, 0, len(extra.FuncAliases))
+	for _, a := range extra.FuncAliases {
+		rows = append(rows, []interface{}{fidOf(a.FuncStart), a.Name})
 	}
+	insertRows(db, "func_alias", []string{"fid", "name"}, rows)
 
 	// func2insns
-	insertStr = "INSERT INTO func2insns (fid, insn) VALUES "
-	value = "(?, ?)"
-	insertFormation = make([]string, 0)
-	vals = make([]interface{}, 0)
-	counter = 0
+	rows = make([][]interface{}, 0)
 	for i, f := range funcLst {
-		insns := f.insns
-		for _, insn := range insns {
-			if counter++; counter >= maxSQLVals {
-				// sqlite3 plugin cannot support too many vals insertion at once
-				counter = 0
-				insertQuey := insertStr + strings.Join(insertFormation, ",")
-				stm, err = db.Prepare(insertQuey)
-				if err != nil {
-					fmt.Println("FATAL: sqlite func2insns statement error")
-					panic(err)
-				}
-				_, err = stm.Exec(vals...)
-				stm.Close()
-				if err != nil {
-					fmt.Println("FATAL: sqlite func2insns value insert error")
-					panic(err)
-				}
-				insertFormation = make([]string, 0)
-				vals = make([]interface{}, 0)
-			}
-			insertFormation = append(insertFormation, value)
-			vals = append(vals, i, insn)
+		for _, insn := range f.insns {
+			rows = append(rows, []interface{}{i, insn})
 		}
 	}
-	insertStr += strings.Join(insertFormation, ",")
-	if len(vals) > 0 {
-		stm, err = db.Prepare(insertStr)
+	insertRows(db, "func2insns", []string{"fid", "insn"}, rows)
+
+	// basic blocks
+	rows = make([][]interface{}, 0)
+	targets := BranchTargets(insns)
+	for i, f := range funcLst {
+		for _, b := range BasicBlocks(f.insns, insns, targets) {
+			rows = append(rows, []interface{}{i, b.Start, b.End, b.InsnCount, b.Origin})
+		}
+	}
+	insertRows(db, "basic_block", []string{"fid", "start", "end", "insn_count", "origin"}, rows)
+
+	// jump tables
+	rows = make([][]interface{}, 0)
+	for _, t := range extra.JumpTables {
+		entries, _ := json.Marshal(t.Entries)
+		targets, _ := json.Marshal(t.Targets)
+		rows = append(rows, []interface{}{fidOf(t.FuncStart), t.Address,
+			t.EntrySize, t.Base, string(entries), string(targets), t.Owner})
+	}
+	insertRows(db, "jump_table",
+		[]string{"fid", "address", "entry_size", "base", "entries", "targets", "owner"}, rows)
+
+	// data regions
+	rows = make([][]interface{}, 0)
+	for _, d := range extra.DataRegions {
+		targets, _ := json.Marshal(d.Targets)
+		rows = append(rows, []interface{}{fidOf(d.FuncStart), d.Start, d.End,
+			d.Kind, d.Directive, string(targets)})
+	}
+	insertRows(db, "data_region",
+		[]string{"fid", "start", "end", "kind", "directive", "targets"}, rows)
+
+	// padding
+	rows = make([][]interface{}, 0)
+	for _, p := range extra.Padding {
+		rows = append(rows, []interface{}{fidOf(p.FuncStart), p.Start, p.End,
+			p.Kind, p.Location, p.Directive})
+	}
+	insertRows(db, "padding",
+		[]string{"fid", "start", "end", "kind", "location", "directive"}, rows)
+
+	// address taken functions
+	rows = make([][]interface{}, 0)
+	for _, a := range extra.AddressTaken {
+		rows = append(rows, []interface{}{a.Location, a.Size, a.Section,
+			a.Target, a.TargetName, fidOf(a.Target)})
+	}
+	insertRows(db, "address_taken",
+		[]string{"location", "size", "section", "target", "target_name", "fid"}, rows)
+
+	// operand symbolization
+	rows = make([][]interface{}, 0)
+	for _, r := range extra.Symbolization {
+		rows = append(rows, []interface{}{r.Insn, r.OperandOffset, r.Size,
+			r.Symbol, r.Addend, r.Target, r.Type})
+	}
+	insertRows(db, "symbolization",
+		[]string{"insn", "operand_offset", "size", "symbol", "addend", "target", "type"}, rows)
+}
+
+// insnBytes returns the hex bytes of an instruction, empty if they are not in
+// the binary
+func insnBytes(bi pstruct.BinaryInfo, offset, length int) string {
+	phy := pstruct.V2PConv(bi.ProgramHeaders, offset)
+	if length <= 0 || phy < 0 || phy+length > len(bi.Sections.Data) {
+		return ""
+	}
+	return hex.EncodeToString(bi.Sections.Data[phy : phy+length])
+}
+
+// sqlRunner runs statements on a database or inside a transaction
+type sqlRunner interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Prepare(query string) (*sql.Stmt, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// createTable creates table "table" with input column definitions
+func createTable(db sqlRunner, table, columns string) {
+	stm, err := db.Prepare("CREATE TABLE IF NOT EXISTS " + table + " (" + columns + ")")
+	if err != nil {
+		fmt.Printf("FATAL: sqlite %s statement error\n", table)
+		panic(err)
+	}
+	stm.Exec()
+	stm.Close()
+}
+
+// insertRows inserts rows into table "table", every row should contain
+// values for all input columns
+func insertRows(db *sql.DB, table string, columns []string, rows [][]interface{}) {
+	// sqlite3 plugin cannot support too many vals insertion at once
+	const maxSQLVals = 900
+	rowsPerInsert := maxSQLVals / len(columns)
+	insertStr := "INSERT INTO " + table + " (" + strings.Join(columns, ", ") + ") VALUES "
+	value := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	for start := 0; start < len(rows); start += rowsPerInsert {
+		end := start + rowsPerInsert
+		if end > len(rows) {
+			end = len(rows)
+		}
+		insertFormation := make([]string, 0, end-start)
+		vals := make([]interface{}, 0, (end-start)*len(columns))
+		for _, row := range rows[start:end] {
+			insertFormation = append(insertFormation, value)
+			vals = append(vals, row...)
+		}
+		stm, err := db.Prepare(insertStr + strings.Join(insertFormation, ","))
 		if err != nil {
-			fmt.Println("FATAL: sqlite func statement error")
+			fmt.Printf("FATAL: sqlite %s statement error\n", table)
 			panic(err)
 		}
 		_, err = stm.Exec(vals...)
+		stm.Close()
 		if err != nil {
-			fmt.Println("FATAL: sqlite func value insert error")
+			fmt.Printf("FATAL: sqlite %s value insert error\n", table)
 			panic(err)
 		}
-		stm.Close()
 	}
 }
 
-// ReadSqliteGt read an sqlite file "sqlpath" for output insn and func data
-func ReadSqliteGt(sqlpath string) (insns map[int]InsnSupplementary, funcs map[FuncRow]bool) {
+// ReadSqliteGt read an sqlite file "sqlpath" for output insn and func data.
+// It fails if the file is not generated from binFile, unless binFile is empty,
+// and if the file has no binary hash when requireHash is set.
+func ReadSqliteGt(sqlpath, binFile string, requireHash bool) (insns map[int]InsnSupplementary, funcs map[FuncRow]bool, failed bool) {
 	insns = make(map[int]InsnSupplementary)
 	funcs = make(map[FuncRow]bool)
 	db, err := sql.Open("sqlite3", sqlpath)
@@ -233,6 +723,11 @@ func ReadSqliteGt(sqlpath string) (insns map[int]InsnSupplementary, funcs map[Fu
 		fmt.Printf("FATAL: sqlite file %s open failed\n", sqlpath)
 		panic(err)
 	}
+	defer db.Close()
+	if binFile != "" && checkBinaryHash(db, sqlpath, binFile, requireHash) {
+		failed = true
+		return
+	}
 
 	const maxSQLQuery = 50000
 	// instructions
@@ -327,6 +822,30 @@ func ReadSqliteGtFuncInOrder(sqlpath string) (funcs []FuncRow) {
 	return
 }
 
+// ReadSqliteGtOrigins read an sqlite file "sqlpath" for the provenance origin
+// of every instruction, empty if the file has no provenance table
+func ReadSqliteGtOrigins(sqlpath string) (origins map[int]string) {
+	origins = make(map[int]string)
+	db, err := sql.Open("sqlite3", sqlpath)
+	if err != nil {
+		fmt.Printf("FATAL: sqlite file %s open failed\n", sqlpath)
+		panic(err)
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT offset, origin FROM provenance")
+	if err != nil {
+		return
+	}
+	var offset int
+	var origin string
+	for rows.Next() {
+		rows.Scan(&offset, &origin)
+		origins[offset] = origin
+	}
+	rows.Close()
+	return
+}
+
 func insnSupplementaryToJSON(supplementary InsnSupplementary) (jsonStr string) {
 	if supplementary.Optional == false {
 		// no need to put supplementary data
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeInsnSupplementary(t *testing.T) {
+	listed := InsnSupplementary{
+		Mnemonic:   "callq",
+		Class:      ClassCall,
+		Length:     5,
+		Edges:      []InsnEdge{{0x1005, EdgeCallReturn}, {0x2000, EdgeCall}},
+		LabelStart: true,
+		Provenance: Provenance{Origin: OriginLst, Lst: "b.s", LstLine: 10},
+	}
+	other := InsnSupplementary{
+		Mnemonic:     "callq",
+		Class:        ClassCall,
+		Length:       5,
+		Edges:        []InsnEdge{{0x3000, EdgeLandingPad}, {0x1005, EdgeCallReturn}},
+		NoReturnCall: true,
+		File:         "b.c",
+		Line:         3,
+		Provenance:   Provenance{Origin: OriginLst, Lst: "a.s", LstLine: 20},
+	}
+	optional := InsnSupplementary{
+		Optional:   true,
+		Mnemonic:   "nop",
+		Class:      ClassNop,
+		Length:     1,
+		Edges:      []InsnEdge{{0x1001, EdgeFallthrough}},
+		TailCall:   true,
+		Provenance: Provenance{Origin: OriginAggressive, Lst: "0.s"},
+	}
+	tests := []struct {
+		name     string
+		old, new InsnSupplementary
+		want     InsnSupplementary
+	}{
+		{"listed records", listed, other, InsnSupplementary{
+			Mnemonic:     "callq",
+			Class:        ClassCall,
+			Length:       5,
+			Edges:        []InsnEdge{{0x1005, EdgeCallReturn}, {0x2000, EdgeCall}, {0x3000, EdgeLandingPad}},
+			LabelStart:   true,
+			NoReturnCall: true,
+			File:         "b.c",
+			Line:         3,
+			Provenance:   other.Provenance,
+		}},
+		{"optional record", optional, listed, InsnSupplementary{
+			Mnemonic:   "callq",
+			Class:      ClassCall,
+			Length:     5,
+			Edges:      []InsnEdge{{0x1001, EdgeFallthrough}, {0x1005, EdgeCallReturn}, {0x2000, EdgeCall}},
+			LabelStart: true,
+			TailCall:   true,
+			Provenance: listed.Provenance,
+		}},
+		{"both optional", optional, optional, optional},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MergeInsnSupplementary(tt.old, tt.new); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeInsnSupplementary(old, new) = %+v, want %+v", got, tt.want)
+			}
+			if got := MergeInsnSupplementary(tt.new, tt.old); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeInsnSupplementary(new, old) = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -10,3 +10,17 @@ type SymbolFuncInfo struct {
 	Line       int
 	Section    string
 }
+
+// FoldedOffsets returns the offsets shared by more than one function symbol,
+// which are produced by identical code folding or function aliases
+func FoldedOffsets(symbolFuncs []SymbolFuncInfo) (folded map[int]bool) {
+	folded = make(map[int]bool)
+	seen := make(map[int]bool)
+	for _, s := range symbolFuncs {
+		if seen[s.Offset] {
+			folded[s.Offset] = true
+		}
+		seen[s.Offset] = true
+	}
+	return
+}